@@ -0,0 +1,190 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"bytes"
+)
+
+// Aggregator combines the values within a subtree into a summary of
+// type S, such as a total or a maximum. Combine must be associative,
+// and Zero must return the identity of Combine, as the summaries are
+// combined in key order but grouped according to the tree structure.
+type Aggregator[V, S any] interface {
+	// Zero returns the summary of an empty subtree.
+	Zero() S
+	// Leaf returns the summary of a single key and value.
+	Leaf(key []byte, val V) S
+	// Combine returns the summary of two adjacent summaries.
+	Combine(a, b S) S
+}
+
+// WithAggregator configures a tree to keep a summary of every subtree
+// using the aggregator. The summaries are updated along the copied
+// path whenever a key is changed, so that Aggregate and AggregateRange
+// can be answered without visiting each key.
+func WithAggregator[V, S any](a Aggregator[V, S]) Option[V] {
+	return func(t *TreeOf[V]) {
+		t.agg = &summary[V, S]{a}
+	}
+}
+
+// Sum returns the aggregated summary of the subtree of this node,
+// or nil if the tree was not configured with an aggregator.
+func (n *NodeOf[V]) Sum() any {
+	if n == nil {
+		return nil
+	}
+	return n.sum
+}
+
+// Aggregate returns the aggregated summary of the keys in the tree
+// which start with the specified prefix. If the tree was not configured
+// with an aggregator, then nil is returned.
+func (t *TreeOf[V]) Aggregate(prefix []byte) any {
+	return aggregate(t.agg, t.root, prefix)
+}
+
+// AggregateRange returns the aggregated summary of the keys in the tree
+// between the start and end keys, as set out by Bounds. If the tree
+// was not configured with an aggregator, then nil is returned.
+func (t *TreeOf[V]) AggregateRange(start, end []byte, b ...Bounds) any {
+	return aggregateRange(t.agg, t.root, start, end, bounds(b))
+}
+
+// Aggregate returns the aggregated summary of the keys in the tree
+// which start with the specified prefix. If the tree was not configured
+// with an aggregator, then nil is returned.
+func (c *CopyOf[V]) Aggregate(prefix []byte) any {
+	return aggregate(c.agg, c.root, prefix)
+}
+
+// AggregateRange returns the aggregated summary of the keys in the tree
+// between the start and end keys, as set out by Bounds. If the tree
+// was not configured with an aggregator, then nil is returned.
+func (c *CopyOf[V]) AggregateRange(start, end []byte, b ...Bounds) any {
+	return aggregateRange(c.agg, c.root, start, end, bounds(b))
+}
+
+// ---------------------------------------------------------------------------
+
+// aggregator hides the summary type of an Aggregator, so that the
+// summaries can be stored on the nodes of a TreeOf[V].
+type aggregator[V any] interface {
+	zero() any
+	leaf(l *leaf[V]) any
+	combine(a, b any) any
+	node(n *NodeOf[V]) any
+}
+
+type summary[V, S any] struct {
+	a Aggregator[V, S]
+}
+
+func (s *summary[V, S]) zero() any {
+	return s.a.Zero()
+}
+
+func (s *summary[V, S]) leaf(l *leaf[V]) any {
+	return s.a.Leaf(l.key, l.val)
+}
+
+func (s *summary[V, S]) combine(a, b any) any {
+	return s.a.Combine(a.(S), b.(S))
+}
+
+func (s *summary[V, S]) node(n *NodeOf[V]) any {
+	sum := s.a.Zero()
+	if n.isLeaf() {
+		sum = s.a.Combine(sum, s.a.Leaf(n.leaf.key, n.leaf.val))
+	}
+	for _, e := range n.edges {
+		sum = s.a.Combine(sum, e.sum.(S))
+	}
+	return sum
+}
+
+func aggregate[V any](a aggregator[V], n *NodeOf[V], prefix []byte) any {
+	if a == nil {
+		return nil
+	}
+	if n = n.under(prefix); n == nil {
+		return a.zero()
+	}
+	return n.sum
+}
+
+func aggregateRange[V any](a aggregator[V], n *NodeOf[V], start, end []byte, b Bounds) any {
+	if a == nil {
+		return nil
+	}
+	return sumRange(a, n, nil, start, end, b)
+}
+
+func sumRange[V any](a aggregator[V], n *NodeOf[V], path, start, end []byte, b Bounds) any {
+
+	sum := a.zero()
+
+	// Include the leaf if it is within the range
+	if n.isLeaf() && within(path, start, end, b) {
+		sum = a.combine(sum, a.leaf(n.leaf))
+	}
+
+	for _, e := range n.edges {
+
+		p := append(path[:len(path):len(path)], e.prefix...)
+
+		// Skip edges entirely outside of the range
+		if start != nil && below(p, start) || end != nil && bytes.Compare(p, end) > 0 {
+			continue
+		}
+
+		// Only the leaf of an edge at the end key can be in the range
+		if end != nil && bytes.Equal(p, end) {
+			if e.isLeaf() && within(p, start, end, b) {
+				sum = a.combine(sum, a.leaf(e.leaf))
+			}
+			break
+		}
+
+		// Include edges entirely within the range
+		if (start == nil || bytes.Compare(p, start) > 0) && (end == nil || below(p, end)) {
+			sum = a.combine(sum, e.sum)
+			continue
+		}
+
+		sum = a.combine(sum, sumRange(a, e, p, start, end, b))
+
+	}
+
+	return sum
+
+}
+
+// within returns whether the key is between the start and end keys,
+// taking into account whether the bounds are included.
+func within(key, start, end []byte, b Bounds) bool {
+	if start != nil {
+		if c := bytes.Compare(key, start); c < 0 || c == 0 && b&IncludeStart == 0 {
+			return false
+		}
+	}
+	if end != nil {
+		if c := bytes.Compare(key, end); c > 0 || c == 0 && b&IncludeEnd == 0 {
+			return false
+		}
+	}
+	return true
+}
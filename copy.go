@@ -18,61 +18,233 @@ import (
 	"bytes"
 )
 
-// Copy is a copy of a tree which can be used to apply changes to
+// CopyOf is a copy of a tree which can be used to apply changes to
 // the radix tree. All changes are applied atomically and a new tree
-// is returned when committed. A Copy is not thread safe.
-type Copy struct {
-	size int
-	root *Node
+// is returned when committed. A copy is not thread safe.
+type CopyOf[V any] struct {
+	size  int
+	root  *NodeOf[V]
+	agg   aggregator[V]
+	hash  Hasher[V]
+	ver   uint64
+	txn   *owner
+	dirty *writes
+	note  bool
+	old   []*NodeOf[V]
+	gone  []*NodeOf[V]
+	rec   bool
+	feed  []Change[V]
+	subs  []Subscriber[V]
 }
 
+// Copy is a copy of a tree which holds values of any type.
+type Copy = CopyOf[any]
+
 // Size is used to return the total number of elements in the tree.
-func (c *Copy) Size() int {
+func (c *CopyOf[V]) Size() int {
 	return c.size
 }
 
 // Root returns the root node within this copy of the radix tree.
-func (c *Copy) Root() *Node {
+// Any nodes created by this copy are now shared with the caller, so
+// subsequent changes to this copy will copy them again, leaving the
+// returned node unchanged.
+func (c *CopyOf[V]) Root() *NodeOf[V] {
+	c.txn = nil
+	return c.root
+}
+
+// top returns the root node without sharing it, for cursors which
+// detect any changes using the version of this copy.
+func (c *CopyOf[V]) top() *NodeOf[V] {
 	return c.root
 }
 
 // Tree returns a new tree with the changes committed in memory.
-func (c *Copy) Tree() *Tree {
-	return &Tree{c.size, c.root}
+// Any nodes created by this copy are now shared with the returned
+// tree, so subsequent changes to this copy will copy them again.
+// Any changes recorded since the copy was last committed are sent
+// to the subscribers of the tree.
+func (c *CopyOf[V]) Tree() *TreeOf[V] {
+	t := c.freeze()
+	c.publish()
+	return t
+}
+
+// freeze returns a new tree with the changes committed in memory,
+// without closing any watch channels or notifying any subscribers.
+func (c *CopyOf[V]) freeze() *TreeOf[V] {
+	c.txn = nil
+	return &TreeOf[V]{size: c.size, root: c.root, agg: c.agg, hash: c.hash, subs: c.subs}
+}
+
+// publish closes the watch channels of any replaced nodes, and of
+// every node within any removed subtrees, and sends any recorded
+// changes to the subscribers, once a tree is committed.
+func (c *CopyOf[V]) publish() {
+	for _, n := range c.old {
+		n.notify()
+	}
+	for _, n := range c.gone {
+		n.notifyAll()
+	}
+	c.old, c.gone = nil, nil
+	if len(c.feed) != 0 {
+		for _, f := range c.subs {
+			f(c.feed)
+		}
+		c.feed = nil
+	}
+}
+
+// Notify specifies whether this copy should close the watch channels
+// of any nodes which it replaces, when it is committed. Tracking the
+// replaced nodes adds a small overhead to each change, and so is not
+// enabled by default.
+func (c *CopyOf[V]) Notify(enable bool) {
+	c.note = enable
+	if !enable {
+		c.old, c.gone = nil, nil
+	}
+}
+
+// Record specifies whether this copy should record the changes which
+// are made to it. Copies of a tree which has any subscribers record
+// their changes by default. Disabling recording throws away any
+// changes which have not yet been committed.
+func (c *CopyOf[V]) Record(enable bool) {
+	c.rec = enable
+	if !enable {
+		c.feed = nil
+	}
+}
+
+// Changes returns the changes which have been recorded by this copy
+// since it was last committed, in the order they were made.
+func (c *CopyOf[V]) Changes() []Change[V] {
+	return c.feed
 }
 
 // Cursor returns a new cursor for iterating through the radix tree.
-func (c *Copy) Cursor() *Cursor {
-	return &Cursor{tree: c}
+func (c *CopyOf[V]) Cursor() *CursorOf[V] {
+	return &CursorOf[V]{IteratorOf: IteratorOf[V]{tree: c}, txn: c}
+}
+
+// Range is used to iterate over the tree in ascending order, only
+// visiting keys between the start and end keys, as set out by Bounds.
+func (c *CopyOf[V]) Range(start, end []byte, f WalkerOf[V], b ...Bounds) {
+	c.Cursor().scan(start, end, bounds(b), f)
+}
+
+// ReverseRange is used to iterate over the tree in descending order,
+// only visiting keys between the start and end keys, as set out by
+// Bounds.
+func (c *CopyOf[V]) ReverseRange(start, end []byte, f WalkerOf[V], b ...Bounds) {
+	c.Cursor().rscan(start, end, bounds(b), f)
 }
 
 // Get is used to retrieve a specific key, returning the current value.
-func (c *Copy) Get(key []byte) interface{} {
+func (c *CopyOf[V]) Get(key []byte) V {
+	val, _ := c.root.get(key)
+	return val
+}
+
+// GetOK is used to retrieve a specific key, returning the current value,
+// and whether the key exists within the tree.
+func (c *CopyOf[V]) GetOK(key []byte) (V, bool) {
 	return c.root.get(key)
 }
 
+// LongestPrefix returns the key and value of the longest key in the
+// tree which is a prefix of the specified key, and whether any such
+// key exists within the tree.
+func (c *CopyOf[V]) LongestPrefix(key []byte) ([]byte, V, bool) {
+	return c.root.match(key).unpackOK()
+}
+
 // Del is used to delete a given key, returning the previous value.
-func (c *Copy) Del(key []byte) interface{} {
-	root, leaf, old := c.del(nil, c.root, key)
+func (c *CopyOf[V]) Del(key []byte) V {
+	old, _ := c.DelOK(key)
+	return old
+}
+
+// DelOK is used to delete a given key, returning the previous value,
+// and whether the key existed within the tree.
+func (c *CopyOf[V]) DelOK(key []byte) (V, bool) {
+	c.written(key)
+	c.ver++
+	root, leaf := c.del(nil, c.root, key)
 	if root != nil {
 		c.root = root
 	}
 	if leaf != nil {
 		c.size--
+		c.record(leaf.key, leaf, nil)
 	}
-	return old
+	_, old, ok := leaf.unpackOK()
+	return old, ok
 }
 
 // Put is used to insert a specific key, returning the previous value.
-func (c *Copy) Put(key []byte, val interface{}) interface{} {
-	root, leaf, old := c.put(nil, c.root, key, key, val)
+func (c *CopyOf[V]) Put(key []byte, val V) V {
+	old, _ := c.PutOK(key, val)
+	return old
+}
+
+// PutOK is used to insert a specific key, returning the previous value,
+// and whether the key already existed within the tree.
+func (c *CopyOf[V]) PutOK(key []byte, val V) (V, bool) {
+	c.written(key)
+	c.ver++
+	root, leaf := c.put(nil, c.root, key, key, val)
 	if root != nil {
 		c.root = root
 	}
 	if leaf == nil {
 		c.size++
 	}
-	return old
+	c.record(key, leaf, &val)
+	_, old, ok := leaf.unpackOK()
+	return old, ok
+}
+
+// DeletePrefix is used to delete every key which starts with the
+// specified prefix, returning the number of keys which were deleted.
+// Matching subtrees are removed whole, only copying the nodes above
+// them in the tree. The deleted keys are only visited if the changes
+// are being recorded.
+func (c *CopyOf[V]) DeletePrefix(prefix []byte) int {
+	c.ver++
+	if len(prefix) == 0 {
+		num := c.drop(c.root)
+		c.root = c.track(&NodeOf[V]{})
+		c.root.update(c.agg, c.hash)
+		c.size -= num
+		c.erased(nil, nil, num)
+		return num
+	}
+	root, num := c.delPrefix(c.root, prefix)
+	if root != nil {
+		c.root = root
+	}
+	c.size -= num
+	c.erased(prefix, limit(prefix), num)
+	return num
+}
+
+// DeleteRange is used to delete every key between the start and end
+// keys, including the start key but excluding the end key, returning
+// the number of keys which were deleted. A nil start or end key leaves
+// that side of the range unbounded. Subtrees which are entirely within
+// the range are removed whole, without visiting their keys, unless the
+// changes are being recorded.
+func (c *CopyOf[V]) DeleteRange(start, end []byte) int {
+	c.ver++
+	root, num := c.delRange(c.root, c.root.prefix, start, end, true)
+	c.root = root
+	c.size -= num
+	c.erased(start, end, num)
+	return num
 }
 
 // ---------------------------------------------------------------------------
@@ -86,6 +258,19 @@ func prefix(a, b []byte) (i int) {
 	return
 }
 
+// limit returns the first key which sorts after every key starting
+// with the prefix, or nil if there is no such key.
+func limit(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			l := append([]byte(nil), prefix[:i+1]...)
+			l[i]++
+			return l
+		}
+	}
+	return nil
+}
+
 func concat(a, b []byte) (c []byte) {
 	c = make([]byte, len(a)+len(b))
 	copy(c, a)
@@ -93,26 +278,118 @@ func concat(a, b []byte) (c []byte) {
 	return
 }
 
-func (c *Copy) del(p, n *Node, s []byte) (*Node, *leaf, interface{}) {
+// writable returns a node which can be modified in place by this
+// copy. Nodes which were created by this copy are returned as is,
+// whilst nodes which are shared with a tree are duplicated first.
+func (c *CopyOf[V]) writable(n *NodeOf[V]) *NodeOf[V] {
+	if c.owns(n) {
+		return n
+	}
+	c.replaced(n)
+	return c.track(n.dup())
+}
+
+// track marks a node as having been created by this copy, so that
+// it can be modified in place by any subsequent changes.
+func (c *CopyOf[V]) track(n *NodeOf[V]) *NodeOf[V] {
+	if c.txn == nil {
+		c.txn = new(owner)
+	}
+	n.owner = c.txn
+	return n
+}
+
+// owns returns whether a node was created by this copy since its
+// nodes were last shared, and so can be modified in place.
+func (c *CopyOf[V]) owns(n *NodeOf[V]) bool {
+	return c.txn != nil && n.owner == c.txn
+}
+
+// replaced records a node as having been replaced by this copy, so
+// that its watch channel can be closed when the copy is committed.
+func (c *CopyOf[V]) replaced(n *NodeOf[V]) {
+	if c.note {
+		if !c.owns(n) {
+			c.old = append(c.old, n)
+		}
+	}
+}
+
+// merge merges the only child of a node into the node itself.
+func (c *CopyOf[V]) merge(n *NodeOf[V]) {
+	c.replaced(n.edges[0])
+	n.mergeChild()
+}
+
+// written records a key as having been modified by this copy, if
+// the modified keys are being tracked.
+func (c *CopyOf[V]) written(key []byte) {
+	if c.dirty != nil {
+		c.dirty.keys[string(key)] = struct{}{}
+	}
+}
+
+// erased records a range of keys as having been deleted by this copy,
+// if the modified keys are being tracked, and any keys were deleted.
+func (c *CopyOf[V]) erased(start, end []byte, num int) {
+	if c.dirty != nil && num != 0 {
+		c.dirty.spans = append(c.dirty.spans, span{
+			start: bytes.Clone(start),
+			end:   bytes.Clone(end),
+		})
+	}
+}
+
+// record appends a change to the change feed of this copy, if the
+// changes are being recorded. A nil old leaf means the key was
+// inserted, and a nil new value means the key was deleted.
+func (c *CopyOf[V]) record(key []byte, old *leaf[V], val *V) {
+	if !c.rec {
+		return
+	}
+	ch := Change[V]{Key: key}
+	switch {
+	case val == nil:
+		ch.Kind, ch.Old = Delete, old.val
+	case old == nil:
+		ch.Kind, ch.New = Insert, *val
+	default:
+		ch.Kind, ch.Old, ch.New = Update, old.val, *val
+	}
+	c.feed = append(c.feed, ch)
+}
+
+// version returns a counter which is incremented whenever this copy
+// is modified, so that cursors can detect any changes.
+func (c *CopyOf[V]) version() uint64 {
+	return c.ver
+}
+
+func (c *CopyOf[V]) del(p, n *NodeOf[V], s []byte) (*NodeOf[V], *leaf[V]) {
 
 	if len(s) == 0 {
 
 		if !n.isLeaf() {
-			return nil, nil, nil
+			return nil, nil
 		}
 
-		d := n.dup()
+		o := n.leaf
+
+		d := c.writable(n)
 
 		// Remove the leaf node
 		d.leaf = nil
+		d.count--
 
 		// Check if the node should be merged
 		if n != c.root && len(d.edges) == 1 {
-			d.mergeChild()
+			c.merge(d)
 		}
 
+		d.update(c.agg, c.hash)
+
 		// Return the found node and leaf node
-		return d, n.leaf, n.leaf.val
+		return d, o
 
 	}
 
@@ -120,53 +397,63 @@ func (c *Copy) del(p, n *Node, s []byte) (*Node, *leaf, interface{}) {
 	l := s[0]
 	i, e := n.getSub(l)
 	if e == nil || !bytes.HasPrefix(s, e.prefix) {
-		return nil, nil, nil
+		return nil, nil
 	}
 
 	// Consume the search prefix
 	s = s[len(e.prefix):]
 
-	node, leaf, old := c.del(n, e, s)
+	node, leaf := c.del(n, e, s)
 	if node == nil {
-		return nil, nil, nil
+		return nil, nil
 	}
 
-	// Copy this node
-	d := n.dup()
-
 	// Delete the edge if the node has no edges
 	if node.leaf == nil && len(node.edges) == 0 {
+		d := c.writable(n)
 		d.delSub(l)
+		d.count--
 		if n != c.root && len(d.edges) == 1 && !d.isLeaf() {
-			d.mergeChild()
+			c.merge(d)
 		}
-	} else {
-		d.edges[i] = node
+		d.update(c.agg, c.hash)
+		return d, leaf
+	}
+
+	// The child was modified in place
+	if node == e {
+		n.count--
+		n.update(c.agg, c.hash)
+		return n, leaf
 	}
 
-	return d, leaf, old
+	// Copy this node
+	d := c.writable(n)
+	d.edges[i] = node
+	d.count--
+	d.update(c.agg, c.hash)
+
+	return d, leaf
 
 }
 
-func (c *Copy) put(p, n *Node, s, k []byte, v interface{}) (*Node, *leaf, interface{}) {
+func (c *CopyOf[V]) put(p, n *NodeOf[V], s, k []byte, v V) (*NodeOf[V], *leaf[V]) {
 
 	if len(s) == 0 {
 
-		d := n.dup()
-
-		// Create the leaf if necessary
-		if !n.isLeaf() {
-			d.leaf = &leaf{key: k}
-		}
+		o := n.leaf
 
-		// Get the old value
-		o := n.leaf.val
+		d := c.writable(n)
 
-		// Update the leaf value
-		d.leaf.val = v
+		// Replace the leaf, as leaves are shared
+		d.leaf = &leaf[V]{key: k, val: v}
+		if o == nil {
+			d.count++
+		}
+		d.update(c.agg, c.hash)
 
 		// Return the new node and leaf node
-		return d, n.leaf, o
+		return d, o
 
 	}
 
@@ -175,16 +462,20 @@ func (c *Copy) put(p, n *Node, s, k []byte, v interface{}) (*Node, *leaf, interf
 
 	// No edge, create one
 	if e == nil {
-		e := &Node{
-			leaf: &leaf{
+		e := c.track(&NodeOf[V]{
+			leaf: &leaf[V]{
 				key: k,
 				val: v,
 			},
 			prefix: s,
-		}
-		d := n.dup()
+			count:  1,
+		})
+		e.update(c.agg, c.hash)
+		d := c.writable(n)
 		d.addSub(e)
-		return d, nil, nil
+		d.count++
+		d.update(c.agg, c.hash)
+		return d, nil
 	}
 
 	// Determine longest prefix of the search key on match
@@ -192,29 +483,38 @@ func (c *Copy) put(p, n *Node, s, k []byte, v interface{}) (*Node, *leaf, interf
 
 	if cl == len(e.prefix) {
 		s = s[cl:]
-		node, leaf, old := c.put(n, e, s, k, v)
-		if node != nil {
-			nc := n.dup()
+		node, leaf := c.put(n, e, s, k, v)
+		if node != e {
+			nc := c.writable(n)
 			nc.edges[i] = node
-			return nc, leaf, old
+			if leaf == nil {
+				nc.count++
+			}
+			nc.update(c.agg, c.hash)
+			return nc, leaf
+		}
+		if leaf == nil {
+			n.count++
 		}
-		return nil, leaf, old
+		n.update(c.agg, c.hash)
+		return n, leaf
 	}
 
 	// Split the node
-	nc := n.dup()
-	splitNode := &Node{
+	nc := c.writable(n)
+	splitNode := c.track(&NodeOf[V]{
 		prefix: s[:cl],
-	}
+		count:  e.count + 1,
+	})
 	nc.repSub(splitNode)
 
 	// Restore the existing child node
-	modChild := e.dup()
-	splitNode.addSub(modChild)
+	modChild := c.writable(e)
 	modChild.prefix = modChild.prefix[cl:]
+	splitNode.addSub(modChild)
 
 	// Create a new leaf node
-	leaf := &leaf{
+	leaf := &leaf[V]{
 		key: k,
 		val: v,
 	}
@@ -223,15 +523,171 @@ func (c *Copy) put(p, n *Node, s, k []byte, v interface{}) (*Node, *leaf, interf
 	s = s[cl:]
 	if len(s) == 0 {
 		splitNode.leaf = leaf
-		return nc, nil, nil
+	} else {
+		// Create a new edge for the node
+		e := c.track(&NodeOf[V]{
+			leaf:   leaf,
+			prefix: s,
+			count:  1,
+		})
+		e.update(c.agg, c.hash)
+		splitNode.addSub(e)
 	}
 
-	// Create a new edge for the node
-	splitNode.addSub(&Node{
-		leaf:   leaf,
-		prefix: s,
-	})
+	splitNode.update(c.agg, c.hash)
+	nc.count++
+	nc.update(c.agg, c.hash)
+
+	return nc, nil
+
+}
+
+func (c *CopyOf[V]) delPrefix(n *NodeOf[V], s []byte) (*NodeOf[V], int) {
+
+	// Look for an edge
+	l := s[0]
+	i, e := n.getSub(l)
+	if e == nil {
+		return nil, 0
+	}
+
+	// Remove the edge if it is under the prefix
+	if bytes.HasPrefix(e.prefix, s) {
+		num := c.drop(e)
+		d := c.writable(n)
+		d.delSub(l)
+		d.count -= num
+		if n != c.root && len(d.edges) == 1 && !d.isLeaf() {
+			c.merge(d)
+		}
+		d.update(c.agg, c.hash)
+		return d, num
+	}
+
+	if !bytes.HasPrefix(s, e.prefix) {
+		return nil, 0
+	}
+
+	// Consume the search prefix
+	node, num := c.delPrefix(e, s[len(e.prefix):])
+	if node == nil {
+		return nil, 0
+	}
+
+	// The child was modified in place
+	if node == e {
+		n.count -= num
+		n.update(c.agg, c.hash)
+		return n, num
+	}
+
+	// Copy this node
+	d := c.writable(n)
+	d.edges[i] = node
+	d.count -= num
+	d.update(c.agg, c.hash)
 
-	return nc, nil, nil
+	return d, num
 
 }
+
+// drop removes a subtree from this copy, returning the number of
+// keys within it. The subtree is kept so that its watch channels can
+// be closed when the copy is committed, and its keys are only visited
+// if the changes are being recorded.
+func (c *CopyOf[V]) drop(n *NodeOf[V]) int {
+	if c.note {
+		c.gone = append(c.gone, n)
+	}
+	if c.rec {
+		c.deleted(n)
+	}
+	return n.count
+}
+
+// deleted records every key within a removed subtree as deleted.
+func (c *CopyOf[V]) deleted(n *NodeOf[V]) {
+	if n.isLeaf() {
+		c.record(n.leaf.key, n.leaf, nil)
+	}
+	for _, e := range n.edges {
+		c.deleted(e)
+	}
+}
+
+func (c *CopyOf[V]) delRange(n *NodeOf[V], path, start, end []byte, root bool) (*NodeOf[V], int) {
+
+	d, num := n, 0
+
+	// Remove the leaf if it is within the range
+	if n.isLeaf() && (start == nil || bytes.Compare(path, start) >= 0) && (end == nil || bytes.Compare(path, end) < 0) {
+		c.record(n.leaf.key, n.leaf, nil)
+		d = c.writable(d)
+		d.leaf = nil
+		num++
+	}
+
+	for i := 0; i < len(d.edges); {
+
+		e := d.edges[i]
+		p := append(path[:len(path):len(path)], e.prefix...)
+
+		// Skip edges entirely outside of the range
+		if start != nil && below(p, start) || end != nil && bytes.Compare(p, end) >= 0 {
+			i++
+			continue
+		}
+
+		// Remove edges entirely within the range
+		if (start == nil || bytes.Compare(p, start) >= 0) && (end == nil || below(p, end)) {
+			num += c.drop(e)
+			d = c.writable(d)
+			d.delSub(e.prefix[0])
+			continue
+		}
+
+		node, k := c.delRange(e, p, start, end, false)
+		if k == 0 {
+			i++
+			continue
+		}
+
+		num += k
+		d = c.writable(d)
+
+		// Delete the edge if the node has no edges
+		if node.leaf == nil && len(node.edges) == 0 {
+			d.delSub(e.prefix[0])
+			continue
+		}
+
+		d.edges[i] = node
+		i++
+
+	}
+
+	if num == 0 {
+		return n, 0
+	}
+
+	d.count -= num
+
+	// Check if the node should be merged
+	if !root && !d.isLeaf() && len(d.edges) == 1 {
+		c.merge(d)
+	}
+
+	d.update(c.agg, c.hash)
+
+	return d, num
+
+}
+
+// below returns whether every key starting with the prefix sorts
+// before the specified key.
+func below(prefix, key []byte) bool {
+	if len(key) > len(prefix) {
+		key = key[:len(prefix)]
+	}
+	return bytes.Compare(prefix, key) < 0
+}
@@ -0,0 +1,183 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"bytes"
+)
+
+// Count returns the number of keys within the subtree of this node.
+func (n *NodeOf[V]) Count() int {
+	if n == nil {
+		return 0
+	}
+	return n.count
+}
+
+// CountPrefix returns the number of keys in the tree which start
+// with the specified prefix.
+func (t *TreeOf[V]) CountPrefix(prefix []byte) int {
+	return t.root.under(prefix).Count()
+}
+
+// CountRange returns the number of keys in the tree between the
+// start and end keys, as set out by Bounds.
+func (t *TreeOf[V]) CountRange(start, end []byte, b ...Bounds) int {
+	return t.root.countRange(start, end, bounds(b))
+}
+
+// Rank returns the number of keys in the tree which sort before the
+// specified key, which is the position the key has, or would have,
+// within the tree. The counts of the edges before the key are added
+// at each node along its path, so this takes time proportional to
+// the length of the key and the number of those edges.
+func (t *TreeOf[V]) Rank(key []byte) int {
+	return t.root.rank(key)
+}
+
+// Select returns the key and value at the specified position within
+// the tree, in ascending order starting from zero. If the position
+// is out of range, then a nil key is returned. Like Rank, this adds
+// the counts of the edges before the position at each node.
+func (t *TreeOf[V]) Select(i int) ([]byte, V) {
+	return t.root.sel(i).unpack()
+}
+
+// CountPrefix returns the number of keys in the tree which start
+// with the specified prefix.
+func (c *CopyOf[V]) CountPrefix(prefix []byte) int {
+	return c.root.under(prefix).Count()
+}
+
+// CountRange returns the number of keys in the tree between the
+// start and end keys, as set out by Bounds.
+func (c *CopyOf[V]) CountRange(start, end []byte, b ...Bounds) int {
+	return c.root.countRange(start, end, bounds(b))
+}
+
+// Rank returns the number of keys in the tree which sort before the
+// specified key, which is the position the key has, or would have,
+// within the tree. The counts of the edges before the key are added
+// at each node along its path, so this takes time proportional to
+// the length of the key and the number of those edges.
+func (c *CopyOf[V]) Rank(key []byte) int {
+	return c.root.rank(key)
+}
+
+// Select returns the key and value at the specified position within
+// the tree, in ascending order starting from zero. If the position
+// is out of range, then a nil key is returned. Like Rank, this adds
+// the counts of the edges before the position at each node.
+func (c *CopyOf[V]) Select(i int) ([]byte, V) {
+	return c.root.sel(i).unpack()
+}
+
+// ---------------------------------------------------------------------------
+
+func (n *NodeOf[V]) countRange(start, end []byte, b Bounds) int {
+
+	lo, hi := 0, n.count
+
+	if start != nil {
+		lo = n.rank(start)
+		if b&IncludeStart == 0 && n.lookup(start) != nil {
+			lo++
+		}
+	}
+
+	if end != nil {
+		hi = n.rank(end)
+		if b&IncludeEnd != 0 && n.lookup(end) != nil {
+			hi++
+		}
+	}
+
+	if hi < lo {
+		return 0
+	}
+
+	return hi - lo
+
+}
+
+func (n *NodeOf[V]) rank(k []byte) (num int) {
+
+	s := k
+
+	for {
+
+		// Check for key exhaution
+		if len(s) == 0 {
+			return
+		}
+
+		// The leaf sorts before any longer key
+		if n.isLeaf() {
+			num++
+		}
+
+		// Count the edges before the search key
+		idx, ok := n.search(s[0])
+		for _, e := range n.edges[:idx] {
+			num += e.count
+		}
+
+		if !ok {
+			return
+		}
+
+		e := n.edges[idx]
+
+		// Consume the search prefix
+		if bytes.HasPrefix(s, e.prefix) {
+			s = s[len(e.prefix):]
+			n = e
+		} else {
+			if below(e.prefix, s) {
+				num += e.count
+			}
+			return
+		}
+
+	}
+
+}
+
+func (n *NodeOf[V]) sel(i int) *leaf[V] {
+
+	if i < 0 || i >= n.count {
+		return nil
+	}
+
+	for {
+
+		if n.isLeaf() {
+			if i == 0 {
+				return n.leaf
+			}
+			i--
+		}
+
+		for _, e := range n.edges {
+			if i < e.count {
+				n = e
+				break
+			}
+			i -= e.count
+		}
+
+	}
+
+}
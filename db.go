@@ -0,0 +1,416 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrConflict is returned when committing a transaction which read
+	// or wrote a key which was changed by another transaction that was
+	// committed after this transaction was started.
+	ErrConflict = errors.New("ptree: transaction conflict")
+	// ErrTxClosed is returned when committing a transaction which has
+	// already been committed or discarded.
+	ErrTxClosed = errors.New("ptree: transaction closed")
+)
+
+// DB represents a radix tree which can be modified concurrently using
+// optimistic transactions. The latest committed tree is held in an
+// atomic pointer, so it can be read at any time without locking.
+type DB[V any] struct {
+	tree atomic.Pointer[TreeOf[V]]
+	lock sync.Mutex
+	ver  uint64
+	log  []*commit
+	open map[uint64]int
+	wal  *wal[V]
+}
+
+// Txn represents an optimistic transaction on a DB. A transaction
+// records the keys which it reads and writes, and these are checked
+// against any transactions which were committed after it was started.
+// A Txn is not thread safe.
+type Txn[V any] struct {
+	db    *DB[V]
+	ver   uint64
+	copy  *CopyOf[V]
+	done  bool
+	reads map[string]struct{}
+}
+
+type commit struct {
+	ver    uint64
+	writes *writes
+}
+
+// writes holds the keys, and the ranges of keys, which were modified
+// by a copy. Deleting a prefix or a range is recorded as a single
+// range, rather than as each of the deleted keys.
+type writes struct {
+	keys  map[string]struct{}
+	spans []span
+}
+
+// span is a range of keys, including the start key and excluding the
+// end key, where a nil end key leaves the range unbounded.
+type span struct {
+	start, end []byte
+}
+
+// NewDB returns a new DB starting with the specified tree. If the
+// tree is nil, then the DB starts off empty.
+func NewDB[V any](t *TreeOf[V]) *DB[V] {
+	if t == nil {
+		t = NewTree[V]()
+	}
+	db := &DB[V]{open: make(map[uint64]int)}
+	db.tree.Store(t)
+	return db
+}
+
+// Tree returns the latest committed tree.
+func (db *DB[V]) Tree() *TreeOf[V] {
+	return db.tree.Load()
+}
+
+// Begin starts a new optimistic transaction from the latest
+// committed tree. The transaction must be finished by calling
+// either Commit or Discard.
+func (db *DB[V]) Begin() *Txn[V] {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.open[db.ver]++
+	return &Txn[V]{
+		db:    db,
+		ver:   db.ver,
+		copy:  db.copy(),
+		reads: make(map[string]struct{}),
+	}
+}
+
+// View calls the function with the latest committed tree. Any error
+// returned by the function is returned from View.
+func (db *DB[V]) View(fn func(*TreeOf[V]) error) error {
+	return fn(db.tree.Load())
+}
+
+// Update calls the function with a new copy of the latest committed
+// tree. If the function returns nil, then the changes are committed,
+// otherwise the changes are discarded, and the error is returned.
+// Updates are applied one at a time, so the function must not begin
+// or commit any other transactions on this DB.
+func (db *DB[V]) Update(fn func(*CopyOf[V]) error) error {
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	c := db.copy()
+
+	if err := fn(c); err != nil {
+		return err
+	}
+
+	if c.dirty.empty() {
+		return nil
+	}
+
+	return db.store(c, c.dirty)
+
+}
+
+// Size is used to return the total number of elements in the tree.
+func (t *Txn[V]) Size() int {
+	return t.copy.Size()
+}
+
+// Get is used to retrieve a specific key, returning the current value.
+func (t *Txn[V]) Get(key []byte) V {
+	val, _ := t.GetOK(key)
+	return val
+}
+
+// GetOK is used to retrieve a specific key, returning the current value,
+// and whether the key exists within the tree.
+func (t *Txn[V]) GetOK(key []byte) (V, bool) {
+	t.reads[string(key)] = struct{}{}
+	return t.copy.GetOK(key)
+}
+
+// Del is used to delete a given key, returning the previous value.
+func (t *Txn[V]) Del(key []byte) V {
+	old, _ := t.DelOK(key)
+	return old
+}
+
+// DelOK is used to delete a given key, returning the previous value,
+// and whether the key existed within the tree.
+func (t *Txn[V]) DelOK(key []byte) (V, bool) {
+	return t.copy.DelOK(key)
+}
+
+// Put is used to insert a specific key, returning the previous value.
+func (t *Txn[V]) Put(key []byte, val V) V {
+	old, _ := t.PutOK(key, val)
+	return old
+}
+
+// PutOK is used to insert a specific key, returning the previous value,
+// and whether the key already existed within the tree.
+func (t *Txn[V]) PutOK(key []byte, val V) (V, bool) {
+	return t.copy.PutOK(key, val)
+}
+
+// DeletePrefix is used to delete every key which starts with the
+// specified prefix, returning the number of keys which were deleted.
+// If any keys are deleted, the transaction conflicts with any other
+// which changes a key with the prefix, whether or not the key existed.
+func (t *Txn[V]) DeletePrefix(prefix []byte) int {
+	return t.copy.DeletePrefix(prefix)
+}
+
+// DeleteRange is used to delete every key between the start and end
+// keys, including the start key but excluding the end key, returning
+// the number of keys which were deleted. If any keys are deleted, the
+// transaction conflicts with any other which changes a key within the
+// range, whether or not the key existed.
+func (t *Txn[V]) DeleteRange(start, end []byte) int {
+	return t.copy.DeleteRange(start, end)
+}
+
+// Discard closes the transaction, throwing away any changes.
+func (t *Txn[V]) Discard() {
+	t.db.lock.Lock()
+	defer t.db.lock.Unlock()
+	t.close()
+}
+
+// Commit closes the transaction, and applies the changes to the DB.
+// If any key which this transaction read or wrote has been changed
+// by a transaction which committed after this one was started, then
+// no changes are applied, and ErrConflict is returned. If the DB is
+// durable, then any error writing the changes to the log is returned,
+// and the changes are not applied. Subscribers of the tree are sent
+// the changes in the order they were made within the transaction.
+func (t *Txn[V]) Commit() error {
+
+	t.db.lock.Lock()
+	defer t.db.lock.Unlock()
+
+	if t.done {
+		return ErrTxClosed
+	}
+
+	defer t.close()
+
+	for _, c := range t.db.log {
+		if c.ver <= t.ver {
+			continue
+		}
+		if c.writes.covers(t.reads) || c.writes.overlaps(t.copy.dirty) {
+			return ErrConflict
+		}
+	}
+
+	if t.copy.dirty.empty() {
+		return nil
+	}
+
+	return t.db.store(t.rebase(), t.copy.dirty)
+
+}
+
+// ---------------------------------------------------------------------------
+
+func (w *writes) empty() bool {
+	return len(w.keys) == 0 && len(w.spans) == 0
+}
+
+// covers returns whether any of the keys were modified.
+func (w *writes) covers(keys map[string]struct{}) bool {
+	if len(keys) > len(w.keys) {
+		for k := range w.keys {
+			if _, ok := keys[k]; ok {
+				return true
+			}
+		}
+	} else {
+		for k := range keys {
+			if _, ok := w.keys[k]; ok {
+				return true
+			}
+		}
+	}
+	for _, s := range w.spans {
+		for k := range keys {
+			if s.contains([]byte(k)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// overlaps returns whether any key was modified by both.
+func (w *writes) overlaps(o *writes) bool {
+	if w.covers(o.keys) {
+		return true
+	}
+	for _, s := range o.spans {
+		for k := range w.keys {
+			if s.contains([]byte(k)) {
+				return true
+			}
+		}
+		for _, t := range w.spans {
+			if s.overlaps(t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s span) contains(key []byte) bool {
+	return bytes.Compare(key, s.start) >= 0 && (s.end == nil || bytes.Compare(key, s.end) < 0)
+}
+
+func (s span) overlaps(t span) bool {
+	return (t.end == nil || bytes.Compare(s.start, t.end) < 0) && (s.end == nil || bytes.Compare(t.start, s.end) < 0)
+}
+
+func (t *Txn[V]) close() {
+	if !t.done {
+		t.done = true
+		t.db.release(t.ver)
+	}
+}
+
+// rebase returns a copy with the changes made within this transaction
+// applied on top of the latest committed tree. If the changes were
+// recorded, then they are replayed in the order they were made, so
+// that subscribers see them as they would have without the rebase.
+// Otherwise the deleted ranges are applied, followed by the final
+// values of the written keys in sorted order.
+func (t *Txn[V]) rebase() *CopyOf[V] {
+
+	// Nothing has been committed since we started
+	if t.ver == t.db.ver {
+		return t.copy
+	}
+
+	c := t.db.tree.Load().Copy()
+	c.Notify(true)
+
+	// Replay the recorded changes on the latest tree
+	if t.copy.rec {
+		for _, ch := range t.copy.feed {
+			if ch.Kind == Delete {
+				c.Del(ch.Key)
+			} else {
+				c.Put(ch.Key, ch.New)
+			}
+		}
+		return c
+	}
+
+	// Replay the deleted ranges on the latest tree
+	for _, s := range t.copy.dirty.spans {
+		c.DeleteRange(s.start, s.end)
+	}
+
+	keys := make([]string, 0, len(t.copy.dirty.keys))
+	for k := range t.copy.dirty.keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Replay the written keys on the latest tree
+	for _, k := range keys {
+		if v, ok := t.copy.GetOK([]byte(k)); ok {
+			c.Put([]byte(k), v)
+		} else {
+			c.Del([]byte(k))
+		}
+	}
+
+	return c
+
+}
+
+// copy returns a new copy of the latest committed tree, which keeps
+// track of any keys which are modified, and which closes the watch
+// channels of any nodes which it replaces.
+func (db *DB[V]) copy() *CopyOf[V] {
+	c := db.tree.Load().Copy()
+	c.dirty = &writes{keys: make(map[string]struct{})}
+	c.Notify(true)
+	return c
+}
+
+// store commits the copy as the latest tree, recording the keys which
+// were changed so that they can be checked by any transactions which
+// are open. If the DB is durable, the changes are first appended to
+// the log. Watch channels are only closed, and subscribers are only
+// notified, once the tree has been stored.
+func (db *DB[V]) store(c *CopyOf[V], w *writes) error {
+	t := c.freeze()
+	if db.wal != nil {
+		if err := db.wal.write(t, w); err != nil {
+			return err
+		}
+	}
+	db.ver++
+	db.tree.Store(t)
+	if len(db.open) > 0 {
+		db.log = append(db.log, &commit{ver: db.ver, writes: w})
+	}
+	c.publish()
+	return nil
+}
+
+// release marks a transaction as finished, and removes any commits
+// which can no longer conflict with any open transactions.
+func (db *DB[V]) release(ver uint64) {
+
+	if db.open[ver]--; db.open[ver] == 0 {
+		delete(db.open, ver)
+	}
+
+	if len(db.open) == 0 {
+		db.log = nil
+		return
+	}
+
+	low := db.ver
+	for v := range db.open {
+		if v < low {
+			low = v
+		}
+	}
+
+	i := 0
+	for i < len(db.log) && db.log[i].ver <= low {
+		db.log[i] = nil
+		i++
+	}
+	db.log = db.log[i:]
+
+}
@@ -0,0 +1,241 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDBTxn(t *testing.T) {
+
+	db := NewDB[int](nil)
+
+	Convey("Can commit a transaction", t, func() {
+		tx := db.Begin()
+		tx.Put([]byte("/one"), 1)
+		tx.Put([]byte("/two"), 2)
+		So(tx.Commit(), ShouldBeNil)
+		So(db.Tree().Size(), ShouldEqual, 2)
+		So(db.Tree().Get([]byte("/one")), ShouldEqual, 1)
+	})
+
+	Convey("Cannot commit a transaction twice", t, func() {
+		tx := db.Begin()
+		So(tx.Commit(), ShouldBeNil)
+		So(tx.Commit(), ShouldEqual, ErrTxClosed)
+		tx = db.Begin()
+		tx.Discard()
+		So(tx.Commit(), ShouldEqual, ErrTxClosed)
+	})
+
+	Convey("Can commit transactions writing separate keys", t, func() {
+		a, b := db.Begin(), db.Begin()
+		a.Put([]byte("/one"), 10)
+		b.Put([]byte("/two"), 20)
+		b.Del([]byte("/none"))
+		So(a.Commit(), ShouldBeNil)
+		So(b.Commit(), ShouldBeNil)
+		So(db.Tree().Get([]byte("/one")), ShouldEqual, 10)
+		So(db.Tree().Get([]byte("/two")), ShouldEqual, 20)
+		So(db.Tree().Size(), ShouldEqual, 2)
+	})
+
+	Convey("Cannot commit transactions writing the same key", t, func() {
+		a, b := db.Begin(), db.Begin()
+		a.Put([]byte("/one"), 100)
+		b.Del([]byte("/one"))
+		b.Put([]byte("/tre"), 3)
+		So(a.Commit(), ShouldBeNil)
+		So(b.Commit(), ShouldEqual, ErrConflict)
+		So(db.Tree().Get([]byte("/one")), ShouldEqual, 100)
+		So(db.Tree().Size(), ShouldEqual, 2)
+	})
+
+	Convey("Cannot commit transactions reading a changed key", t, func() {
+		a, b := db.Begin(), db.Begin()
+		a.Put([]byte("/two"), 200)
+		b.Put([]byte("/tre"), b.Get([]byte("/two"))+1)
+		So(a.Commit(), ShouldBeNil)
+		So(b.Commit(), ShouldEqual, ErrConflict)
+		So(db.Tree().Get([]byte("/two")), ShouldEqual, 200)
+		_, ok := db.Tree().GetOK([]byte("/tre"))
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Can commit transactions reading a key changed before they started", t, func() {
+		a := db.Begin()
+		a.Put([]byte("/two"), 2000)
+		So(a.Commit(), ShouldBeNil)
+		b := db.Begin()
+		b.Put([]byte("/tre"), b.Get([]byte("/two"))+1)
+		So(b.Commit(), ShouldBeNil)
+		So(db.Tree().Get([]byte("/tre")), ShouldEqual, 2001)
+	})
+
+	Convey("Cannot commit transactions writing within a deleted prefix", t, func() {
+		db := NewDB[int](nil)
+		db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/tw"), 0)
+			c.Put([]byte("/two"), 2)
+			return nil
+		})
+		a, b := db.Begin(), db.Begin()
+		So(a.DeletePrefix([]byte("/tw")), ShouldEqual, 2)
+		b.Put([]byte("/twelve"), 12)
+		So(a.Commit(), ShouldBeNil)
+		So(b.Commit(), ShouldEqual, ErrConflict)
+		So(db.Tree().Size(), ShouldEqual, 0)
+	})
+
+	Convey("Cannot commit transactions reading within a deleted range", t, func() {
+		db := NewDB[int](nil)
+		db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/one"), 1)
+			return nil
+		})
+		a, b := db.Begin(), db.Begin()
+		b.Put([]byte("/tre"), b.Get([]byte("/one"))+2)
+		So(a.DeleteRange([]byte("/o"), []byte("/p")), ShouldEqual, 1)
+		So(a.Commit(), ShouldBeNil)
+		So(b.Commit(), ShouldEqual, ErrConflict)
+		So(db.Tree().Size(), ShouldEqual, 0)
+	})
+
+	Convey("Can rebase transactions which delete a range", t, func() {
+		db := NewDB[int](nil)
+		db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/one"), 1)
+			c.Put([]byte("/two"), 2)
+			return nil
+		})
+		a, b := db.Begin(), db.Begin()
+		a.Put([]byte("/zzz"), 26)
+		b.Put([]byte("/tre"), 3)
+		So(b.DeleteRange(nil, []byte("/tre")), ShouldEqual, 1)
+		b.Put([]byte("/for"), 4)
+		So(a.Commit(), ShouldBeNil)
+		So(b.Commit(), ShouldBeNil)
+		_, ok := db.Tree().GetOK([]byte("/one"))
+		So(ok, ShouldBeFalse)
+		So(db.Tree().Get([]byte("/for")), ShouldEqual, 4)
+		So(db.Tree().Get([]byte("/tre")), ShouldEqual, 3)
+		So(db.Tree().Get([]byte("/two")), ShouldEqual, 2)
+		So(db.Tree().Get([]byte("/zzz")), ShouldEqual, 26)
+		So(db.Tree().Size(), ShouldEqual, 4)
+	})
+
+	Convey("Sends the changes of a rebased transaction in order", t, func() {
+		var feed []Change[int]
+		db := NewDB(NewTree(WithSubscriber(func(c []Change[int]) {
+			feed = append(feed, c...)
+		})))
+		a, b := db.Begin(), db.Begin()
+		a.Put([]byte("/one"), 10)
+		b.Put([]byte("/tre"), 3)
+		b.Put([]byte("/two"), 2)
+		b.Put([]byte("/for"), 4)
+		b.Del([]byte("/two"))
+		So(a.Commit(), ShouldBeNil)
+		feed = nil
+		So(b.Commit(), ShouldBeNil)
+		So(feed, ShouldResemble, []Change[int]{
+			{Key: []byte("/tre"), New: 3, Kind: Insert},
+			{Key: []byte("/two"), New: 2, Kind: Insert},
+			{Key: []byte("/for"), New: 4, Kind: Insert},
+			{Key: []byte("/two"), Old: 2, Kind: Delete},
+		})
+		So(db.Tree().Size(), ShouldEqual, 3)
+	})
+
+	Convey("Can commit transactions concurrently", t, func() {
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					for {
+						tx := db.Begin()
+						tx.Put([]byte("/count"), tx.Get([]byte("/count"))+1)
+						if tx.Commit() == nil {
+							break
+						}
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		So(db.Tree().Get([]byte("/count")), ShouldEqual, 800)
+		So(db.log, ShouldBeEmpty)
+		So(db.open, ShouldBeEmpty)
+	})
+
+}
+
+func TestDBUpdate(t *testing.T) {
+
+	db := NewDB[int](nil)
+
+	Convey("Can commit an update", t, func() {
+		err := db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/one"), 1)
+			c.Put([]byte("/two"), 2)
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(db.Tree().Size(), ShouldEqual, 2)
+	})
+
+	Convey("Can discard a failed update", t, func() {
+		fail := errors.New("fail")
+		err := db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/tre"), 3)
+			c.Del([]byte("/one"))
+			return fail
+		})
+		So(err, ShouldEqual, fail)
+		So(db.Tree().Size(), ShouldEqual, 2)
+		So(db.Tree().Get([]byte("/one")), ShouldEqual, 1)
+	})
+
+	Convey("Can view the latest tree", t, func() {
+		err := db.View(func(t *TreeOf[int]) error {
+			So(t.Get([]byte("/two")), ShouldEqual, 2)
+			So(t.Size(), ShouldEqual, 2)
+			return nil
+		})
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Updates conflict with open transactions", t, func() {
+		tx := db.Begin()
+		tx.Put([]byte("/one"), tx.Get([]byte("/one"))+1)
+		err := db.Update(func(c *CopyOf[int]) error {
+			i := c.Cursor()
+			i.Seek([]byte("/one"))
+			i.Del()
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(tx.Commit(), ShouldEqual, ErrConflict)
+		_, ok := db.Tree().GetOK([]byte("/one"))
+		So(ok, ShouldBeFalse)
+	})
+
+}
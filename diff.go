@@ -0,0 +1,159 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"bytes"
+)
+
+// ChangeKind describes how a key differs between two trees.
+type ChangeKind uint8
+
+const (
+	// Insert means the key only exists in the newer tree.
+	Insert ChangeKind = iota + 1
+	// Update means the key exists in both trees, but was put again.
+	Update
+	// Delete means the key only exists in the older tree.
+	Delete
+)
+
+// String returns the name of the change kind.
+func (k ChangeKind) String() string {
+	switch k {
+	case Insert:
+		return "insert"
+	case Update:
+		return "update"
+	case Delete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Differ is used when diffing two trees, and is called with each key
+// which differs between them. For inserted keys the old value is the
+// zero value, and for deleted keys the new value is the zero value.
+type Differ[V any] func(key []byte, old, new V, kind ChangeKind) (exit bool)
+
+// Diff calls the function with every key which differs between the
+// trees a and b, in key order. Any subtree which is shared by both
+// trees is skipped without being walked. A key is reported as updated
+// whenever it was put again, even if it was put with an equal value,
+// unless both trees are hashed, in which case any subtrees with equal
+// hashes are also skipped.
+// If the function returns true, then the diff stops.
+func Diff[V any](a, b *TreeOf[V], f Differ[V]) {
+
+	x := newStream(a.root)
+	y := newStream(b.root)
+
+	for {
+
+		var o, n *leaf[V]
+
+		xi, xok := x.peek()
+		yi, yok := y.peek()
+
+		switch {
+		case !xok && !yok:
+			return
+		case !yok:
+			o = xi.node.leaf
+			x.descend()
+		case !xok:
+			n = yi.node.leaf
+			y.descend()
+		default:
+			switch c := bytes.Compare(xi.path, yi.path); {
+			case c < 0:
+				o = xi.node.leaf
+				x.descend()
+			case c > 0:
+				n = yi.node.leaf
+				y.descend()
+			case xi.node == yi.node, same(xi.node, yi.node):
+				x.skip()
+				y.skip()
+				continue
+			default:
+				o, n = xi.node.leaf, yi.node.leaf
+				x.descend()
+				y.descend()
+			}
+		}
+
+		if o == n {
+			continue
+		}
+
+		var exit bool
+		var zero V
+
+		switch {
+		case o == nil:
+			exit = f(n.key, zero, n.val, Insert)
+		case n == nil:
+			exit = f(o.key, o.val, zero, Delete)
+		default:
+			exit = f(n.key, o.val, n.val, Update)
+		}
+
+		if exit {
+			return
+		}
+
+	}
+
+}
+
+// ---------------------------------------------------------------------------
+
+type streamItem[V any] struct {
+	node *NodeOf[V]
+	path []byte
+}
+
+// stream visits the nodes of a tree in pre-order, which is also the
+// order of their full paths, allowing whole subtrees to be skipped.
+type stream[V any] struct {
+	stack []streamItem[V]
+}
+
+func newStream[V any](n *NodeOf[V]) *stream[V] {
+	return &stream[V]{stack: []streamItem[V]{{node: n, path: n.prefix}}}
+}
+
+func (s *stream[V]) peek() (streamItem[V], bool) {
+	if len(s.stack) == 0 {
+		return streamItem[V]{}, false
+	}
+	return s.stack[len(s.stack)-1], true
+}
+
+func (s *stream[V]) skip() {
+	s.stack = s.stack[:len(s.stack)-1]
+}
+
+func (s *stream[V]) descend() {
+	i := s.stack[len(s.stack)-1]
+	s.skip()
+	for j := len(i.node.edges) - 1; j >= 0; j-- {
+		e := i.node.edges[j]
+		p := make([]byte, 0, len(i.path)+len(e.prefix))
+		p = append(append(p, i.path...), e.prefix...)
+		s.stack = append(s.stack, streamItem[V]{node: e, path: p})
+	}
+}
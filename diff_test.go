@@ -0,0 +1,135 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func diff[V any](a, b *TreeOf[V]) (out []string) {
+	Diff(a, b, func(key []byte, old, new V, kind ChangeKind) bool {
+		out = append(out, fmt.Sprintf("%s %s %v %v", kind, key, old, new))
+		return false
+	})
+	return
+}
+
+func TestDiff(t *testing.T) {
+
+	c := NewTree[int]().Copy()
+
+	for i, v := range s {
+		c.Put([]byte(v), i)
+	}
+
+	a := c.Tree()
+
+	Convey("Identical trees have no differences", t, func() {
+		So(diff(a, a), ShouldBeEmpty)
+		So(diff(NewTree[int](), NewTree[int]()), ShouldBeEmpty)
+	})
+
+	Convey("Can diff against an empty tree", t, func() {
+		ins := diff(NewTree[int](), a)
+		del := diff(a, NewTree[int]())
+		So(ins, ShouldHaveLength, len(s))
+		So(del, ShouldHaveLength, len(s))
+		So(ins[0], ShouldEqual, "insert /some 0 0")
+		So(del[0], ShouldEqual, "delete /some 0 0")
+	})
+
+	Convey("Reports changes in key order", t, func() {
+		c := a.Copy()
+		c.Put([]byte("/test/one"), 20)
+		c.Del([]byte("/test/one/sub-one"))
+		c.Put([]byte("/test/one/sub-one/1st/new"), 30)
+		c.Put([]byte("/aaa"), 40)
+		c.Del([]byte("/zoo"))
+		So(diff(a, c.Tree()), ShouldResemble, []string{
+			"insert /aaa 0 40",
+			"update /test/one 2 20",
+			"delete /test/one/sub-one 3 0",
+			"insert /test/one/sub-one/1st/new 0 30",
+			"delete /zoo 32 0",
+		})
+	})
+
+	Convey("Can stop diffing", t, func() {
+		var keys []string
+		Diff(NewTree[int](), a, func(key []byte, old, new int, kind ChangeKind) bool {
+			keys = append(keys, string(key))
+			return len(keys) == 3
+		})
+		So(keys, ShouldResemble, s[:3])
+	})
+
+	Convey("Matches a brute force diff", t, func() {
+		r := rand.New(rand.NewSource(1))
+		c := NewTree[int]().Copy()
+		for i := 0; i < 2000; i++ {
+			c.Put([]byte(fmt.Sprintf("%x", r.Intn(4096))), i)
+		}
+		prev := c.Tree()
+		for round := 0; round < 20; round++ {
+			c := prev.Copy()
+			put := map[string]bool{}
+			for i := 0; i < 50; i++ {
+				k := []byte(fmt.Sprintf("%x", r.Intn(4096)))
+				if r.Intn(2) == 0 {
+					c.Put(k, -i)
+					put[string(k)] = true
+				} else {
+					c.Del(k)
+					delete(put, string(k))
+				}
+			}
+			next := c.Tree()
+			old, new := map[string]int{}, map[string]int{}
+			prev.Walk(nil, func(k []byte, v int) bool { old[string(k)] = v; return false })
+			next.Walk(nil, func(k []byte, v int) bool { new[string(k)] = v; return false })
+			var keys []string
+			for k := range old {
+				keys = append(keys, k)
+			}
+			for k := range new {
+				if _, ok := old[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			var expect []string
+			for _, k := range keys {
+				o, ook := old[k]
+				n, nok := new[k]
+				switch {
+				case !ook:
+					expect = append(expect, fmt.Sprintf("insert %s 0 %v", k, n))
+				case !nok:
+					expect = append(expect, fmt.Sprintf("delete %s %v 0", k, o))
+				case put[k]:
+					expect = append(expect, fmt.Sprintf("update %s %v %v", k, o, n))
+				}
+			}
+			So(diff(prev, next), ShouldResemble, expect)
+			prev = next
+		}
+	})
+
+}
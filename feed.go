@@ -0,0 +1,40 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+// Change describes a single change which was made to a Copy. For
+// inserted keys the old value is the zero value, and for deleted
+// keys the new value is the zero value.
+type Change[V any] struct {
+	Key  []byte
+	Old  V
+	New  V
+	Kind ChangeKind
+}
+
+// Subscriber is called with the changes made by a Copy, in the order
+// they were made, whenever the copy is committed using Tree. It is
+// called synchronously, so it must not modify the copy. The slice is
+// shared between all of the subscribers, so must not be modified.
+type Subscriber[V any] func(changes []Change[V])
+
+// WithSubscriber configures a tree to send the changes made by any
+// copies of it, or of trees derived from it, to the subscriber when
+// the copies are committed.
+func WithSubscriber[V any](f Subscriber[V]) Option[V] {
+	return func(t *TreeOf[V]) {
+		t.subs = append(t.subs[:len(t.subs):len(t.subs)], f)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFeed(t *testing.T) {
+
+	Convey("Changes are not recorded by default", t, func() {
+		c := NewTree[int]().Copy()
+		c.Put([]byte("/one"), 1)
+		So(c.Changes(), ShouldBeEmpty)
+	})
+
+	Convey("Can record changes made to a copy", t, func() {
+		c := NewTree[int]().Copy()
+		c.Record(true)
+		c.Put([]byte("/one"), 1)
+		c.Put([]byte("/one"), 2)
+		c.Del([]byte("/two"))
+		c.Del([]byte("/one"))
+		So(c.Changes(), ShouldResemble, []Change[int]{
+			{Key: []byte("/one"), New: 1, Kind: Insert},
+			{Key: []byte("/one"), Old: 1, New: 2, Kind: Update},
+			{Key: []byte("/one"), Old: 2, Kind: Delete},
+		})
+		c.Tree()
+		So(c.Changes(), ShouldBeEmpty)
+	})
+
+	Convey("Can record keys deleted by prefix and range", t, func() {
+		c := NewTree[int]().Copy()
+		for i, k := range []string{"/a", "/a/1", "/a/2", "/b", "/b/1", "/c"} {
+			c.Put([]byte(k), i)
+		}
+		c.Tree()
+		c.Record(true)
+		c.DeletePrefix([]byte("/a"))
+		c.DeleteRange([]byte("/b/"), nil)
+		So(c.Changes(), ShouldResemble, []Change[int]{
+			{Key: []byte("/a"), Old: 0, Kind: Delete},
+			{Key: []byte("/a/1"), Old: 1, Kind: Delete},
+			{Key: []byte("/a/2"), Old: 2, Kind: Delete},
+			{Key: []byte("/b/1"), Old: 4, Kind: Delete},
+			{Key: []byte("/c"), Old: 5, Kind: Delete},
+		})
+		c.Record(false)
+		So(c.Changes(), ShouldBeEmpty)
+	})
+
+	Convey("Subscribers receive the changes when committed", t, func() {
+		var got [][]Change[int]
+		c := NewTree(WithSubscriber(func(changes []Change[int]) {
+			got = append(got, changes)
+		})).Copy()
+		c.Put([]byte("/one"), 1)
+		So(got, ShouldBeEmpty)
+		p := c.Tree()
+		So(got, ShouldHaveLength, 1)
+		So(got[0], ShouldHaveLength, 1)
+		c.Tree()
+		So(got, ShouldHaveLength, 1)
+		c = p.Copy()
+		c.Del([]byte("/one"))
+		c.Tree()
+		So(got, ShouldHaveLength, 2)
+		So(got[1], ShouldResemble, []Change[int]{
+			{Key: []byte("/one"), Old: 1, Kind: Delete},
+		})
+	})
+
+	Convey("Subscribers receive the changes committed to a DB", t, func() {
+		var got []Change[int]
+		db := NewDB(NewTree(WithSubscriber(func(changes []Change[int]) {
+			got = append(got, changes...)
+		})))
+		a, b := db.Begin(), db.Begin()
+		a.Put([]byte("/one"), 1)
+		b.Put([]byte("/two"), 2)
+		So(a.Commit(), ShouldBeNil)
+		So(b.Commit(), ShouldBeNil)
+		So(got, ShouldResemble, []Change[int]{
+			{Key: []byte("/one"), New: 1, Kind: Insert},
+			{Key: []byte("/two"), New: 2, Kind: Insert},
+		})
+	})
+
+}
@@ -1,6 +1,6 @@
 module github.com/surrealdb/ptree
 
-go 1.17
+go 1.23
 
 require github.com/smartystreets/goconvey v1.7.2
 
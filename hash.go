@@ -0,0 +1,161 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// Hasher is used to include values in the hashes of the nodes of a
+// tree. Equal values must always return equal bytes, even across
+// processes, so that trees can be compared by hash.
+type Hasher[V any] interface {
+	// Hash returns the bytes of the value which are hashed, such as
+	// its encoding or a digest of it.
+	Hash(val V) []byte
+}
+
+// WithHasher configures a tree to keep a SHA-256 hash of every subtree,
+// covering the keys and values within it. The hashes are updated along
+// the copied path whenever a key is changed. As the structure of a
+// radix tree only depends on its keys, two trees holding the same keys
+// and values have the same hashes, even in different processes.
+func WithHasher[V any](h Hasher[V]) Option[V] {
+	return func(t *TreeOf[V]) {
+		t.hash = h
+	}
+}
+
+// Hash returns the hash of the subtree of this node, or nil if the
+// tree was not configured with a hasher. The hash covers the keys
+// and values within the subtree, relative to the path of this node.
+func (n *NodeOf[V]) Hash() []byte {
+	if n == nil {
+		return nil
+	}
+	return n.hash
+}
+
+// Hash returns the hash of the whole tree, or nil if the tree was
+// not configured with a hasher.
+func (t *TreeOf[V]) Hash() []byte {
+	return t.root.hash
+}
+
+// HashPrefix returns the hash of the keys and values in the tree
+// which start with the specified prefix, so that the same prefix can
+// be compared between trees, descending only into the prefixes which
+// differ. If there are no such keys, or the tree was not configured
+// with a hasher, then nil is returned.
+func (t *TreeOf[V]) HashPrefix(prefix []byte) []byte {
+	return t.root.hashPrefix(prefix)
+}
+
+// Hash returns the hash of the whole tree, or nil if the tree was
+// not configured with a hasher.
+func (c *CopyOf[V]) Hash() []byte {
+	return c.root.hash
+}
+
+// HashPrefix returns the hash of the keys and values in the tree
+// which start with the specified prefix, so that the same prefix can
+// be compared between trees, descending only into the prefixes which
+// differ. If there are no such keys, or the tree was not configured
+// with a hasher, then nil is returned.
+func (c *CopyOf[V]) HashPrefix(prefix []byte) []byte {
+	return c.root.hashPrefix(prefix)
+}
+
+// ---------------------------------------------------------------------------
+
+// digest calculates the hash of a node from its leaf value, and the
+// prefixes and hashes of its edges. The prefix of the node itself is
+// not included, as it depends on the keys outside of its subtree.
+func digest[V any](n *NodeOf[V], h Hasher[V]) []byte {
+
+	d := sha256.New()
+
+	var buf [binary.MaxVarintLen64]byte
+
+	write := func(b []byte) {
+		d.Write(buf[:binary.PutUvarint(buf[:], uint64(len(b)))])
+		d.Write(b)
+	}
+
+	if n.isLeaf() {
+		d.Write([]byte{1})
+		write(h.Hash(n.leaf.val))
+	} else {
+		d.Write([]byte{0})
+	}
+
+	for _, e := range n.edges {
+		write(e.prefix)
+		d.Write(e.hash)
+	}
+
+	return d.Sum(nil)
+
+}
+
+// hashPrefix returns the hash of the subtree containing exactly the
+// keys which start with the prefix. If the edge leading to that
+// subtree extends beyond the prefix, then the remainder of the edge
+// is hashed along with the subtree.
+func (n *NodeOf[V]) hashPrefix(k []byte) []byte {
+
+	s := k
+
+	for {
+
+		// Check for key exhaution
+		if len(s) == 0 {
+			return n.hash
+		}
+
+		// Look for an edge
+		if _, n = n.getSub(s[0]); n == nil {
+			return nil
+		}
+
+		// Consume the search prefix
+		if bytes.HasPrefix(s, n.prefix) {
+			s = s[len(n.prefix):]
+		} else if bytes.HasPrefix(n.prefix, s) {
+			break
+		} else {
+			return nil
+		}
+
+	}
+
+	if n.hash == nil {
+		return nil
+	}
+
+	d := sha256.New()
+	d.Write(n.prefix[len(s):])
+	d.Write(n.hash)
+	return d.Sum(nil)
+
+}
+
+// same returns whether two nodes at the same path have equal hashes,
+// and so contain the same keys and values.
+func same[V any](a, b *NodeOf[V]) bool {
+	return a.hash != nil && bytes.Equal(a.hash, b.hash)
+}
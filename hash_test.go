@@ -0,0 +1,111 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type bytesHasher struct{}
+
+func (bytesHasher) Hash(val []byte) []byte { return val }
+
+func TestHash(t *testing.T) {
+
+	hashed := func(keys []string) *TreeOf[[]byte] {
+		c := NewTree(WithHasher[[]byte](bytesHasher{})).Copy()
+		for _, k := range keys {
+			c.Put([]byte(k), []byte(k))
+		}
+		return c.Tree()
+	}
+
+	p := hashed(s)
+
+	Convey("Trees without a hasher have no hashes", t, func() {
+		So(New().Hash(), ShouldBeNil)
+		So(New().HashPrefix([]byte("/test")), ShouldBeNil)
+	})
+
+	Convey("Trees with the same keys have the same hashes", t, func() {
+		r := append([]string(nil), s...)
+		rand.New(rand.NewSource(1)).Shuffle(len(r), func(i, j int) {
+			r[i], r[j] = r[j], r[i]
+		})
+		c := hashed(append(r, "/extra", "/test/one/extra")).Copy()
+		c.Del([]byte("/extra"))
+		c.Del([]byte("/test/one/extra"))
+		So(p.Hash(), ShouldHaveLength, 32)
+		So(c.Hash(), ShouldResemble, p.Hash())
+		c = p.Copy()
+		c.DeletePrefix([]byte("/test/one"))
+		c.DeleteRange([]byte("/foo"), []byte("/test"))
+		So(c.Hash(), ShouldNotResemble, p.Hash())
+		for _, k := range s {
+			if bytes.HasPrefix([]byte(k), []byte("/test/one")) || k >= "/foo" && k < "/test" {
+				c.Put([]byte(k), []byte(k))
+			}
+		}
+		So(c.Hash(), ShouldResemble, p.Hash())
+	})
+
+	Convey("Trees with different values have different hashes", t, func() {
+		c := p.Copy()
+		c.Put([]byte("/test/one"), []byte("changed"))
+		So(c.Hash(), ShouldNotResemble, p.Hash())
+		So(c.HashPrefix([]byte("/test/one")), ShouldNotResemble, p.HashPrefix([]byte("/test/one")))
+		So(c.HashPrefix([]byte("/test/two")), ShouldResemble, p.HashPrefix([]byte("/test/two")))
+	})
+
+	Convey("Prefixes can be compared between differently shaped trees", t, func() {
+		a := hashed([]string{"/ab1", "/ab2"})
+		b := hashed([]string{"/ab1", "/ab2", "/ac"})
+		So(a.Hash(), ShouldNotResemble, b.Hash())
+		So(a.HashPrefix([]byte("/ab")), ShouldResemble, b.HashPrefix([]byte("/ab")))
+		So(a.HashPrefix([]byte("/a")), ShouldNotResemble, b.HashPrefix([]byte("/a")))
+		x := hashed([]string{"/ab"})
+		y := hashed([]string{"/ax"})
+		So(x.HashPrefix([]byte("/a")), ShouldNotBeNil)
+		So(x.HashPrefix([]byte("/a")), ShouldNotResemble, y.HashPrefix([]byte("/a")))
+		So(x.HashPrefix([]byte("/b")), ShouldBeNil)
+	})
+
+	Convey("Hashes are restored from snapshots", t, func() {
+		var buf bytes.Buffer
+		_, err := p.Snapshot(BytesCodec{}).WriteTo(&buf)
+		So(err, ShouldBeNil)
+		r := NewSnapshot[[]byte](BytesCodec{}, WithHasher[[]byte](bytesHasher{}))
+		_, err = r.ReadFrom(&buf)
+		So(err, ShouldBeNil)
+		So(r.Tree().Hash(), ShouldResemble, p.Hash())
+	})
+
+	Convey("Diff skips subtrees with equal hashes", t, func() {
+		c := p.Copy()
+		c.Put([]byte("/test/one"), []byte("/test/one"))
+		c.Put([]byte("/zoo"), []byte("changed"))
+		var keys []string
+		Diff(p, c.Tree(), func(k, _, _ []byte, _ ChangeKind) bool {
+			keys = append(keys, string(k))
+			return false
+		})
+		So(keys, ShouldResemble, []string{"/zoo"})
+	})
+
+}
@@ -18,29 +18,51 @@ import (
 	"bytes"
 )
 
-// Cursor represents an iterator that can traverse over all key-value
+// IteratorOf represents a read-only iterator that can traverse over
+// all key-value pairs in a tree in sorted order. Iterators can be
+// obtained from a tree, and as trees are immutable, any number of
+// iterators can be used concurrently on the same tree. An iterator
+// itself is not thread safe.
+type IteratorOf[V any] struct {
+	tree reader[V]
+	ver  uint64
+	seek []byte
+	path []*item[V]
+}
+
+// CursorOf represents an iterator that can traverse over all key-value
 // pairs in a tree in sorted order. Cursors can be obtained from a
 // transaction and are valid as long as the transaction is open.
-// Changing data while traversing with a cursor may cause it to be
-// invalidated and return unexpected keys and/or values. You must
-// reposition your cursor after mutating data.
-type Cursor struct {
-	tree *Copy
-	seek []byte
-	path []*item
+// Data can be changed while traversing with a cursor, using either
+// the cursor or the transaction. Next and Prev will then continue
+// from the position of the current key, even if it was deleted.
+type CursorOf[V any] struct {
+	IteratorOf[V]
+	txn *CopyOf[V]
+}
+
+// Iterator is an iterator over a tree which holds values of any type.
+type Iterator = IteratorOf[any]
+
+// Cursor is a cursor over a copy which holds values of any type.
+type Cursor = CursorOf[any]
+
+type reader[V any] interface {
+	top() *NodeOf[V]
+	version() uint64
 }
 
-type item struct {
+type item[V any] struct {
 	pos  int
-	node *Node
+	node *NodeOf[V]
 }
 
 // Del removes the current item under the cursor from the tree. If
 // the cursor has not yet been positioned using First, Last, or Seek,
 // then no item is deleted and a nil key and value are returned.
-func (c *Cursor) Del() ([]byte, interface{}) {
+func (c *CursorOf[V]) Del() ([]byte, V) {
 
-	val := c.tree.Del(c.seek)
+	val := c.txn.Del(c.seek)
 
 	return c.seek, val
 
@@ -49,22 +71,22 @@ func (c *Cursor) Del() ([]byte, interface{}) {
 // First moves the cursor to the first item in the tree and returns
 // its key and value. If the tree is empty then a nil key and value
 // are returned.
-func (c *Cursor) First() ([]byte, interface{}) {
+func (i *IteratorOf[V]) First() ([]byte, V) {
 
-	c.path = nil
+	i.path = nil
 
-	return c.first(c.tree.root)
+	return i.first(i.root()).unpack()
 
 }
 
 // Last moves the cursor to the last item in the tree and returns its
 // key and value. If the tree is empty then a nil key and value are
 // returned.
-func (c *Cursor) Last() ([]byte, interface{}) {
+func (i *IteratorOf[V]) Last() ([]byte, V) {
 
-	c.path = nil
+	i.path = nil
 
-	return c.last(c.tree.root)
+	return i.last(i.root()).unpack()
 
 }
 
@@ -73,12 +95,120 @@ func (c *Cursor) Last() ([]byte, interface{}) {
 // returned, and if the cursor is at the start of the tree then a nil key
 // and value are returned. If the cursor has not yet been positioned
 // using First, Last, or Seek, then a nil key and value are returned.
-func (c *Cursor) Prev() ([]byte, interface{}) {
+func (i *IteratorOf[V]) Prev() ([]byte, V) {
+
+	return i.prev().unpack()
+
+}
+
+// Next moves the cursor to the next item in the tree and returns its
+// key and value. If the tree is empty then a nil key and value are
+// returned, and if the cursor is at the end of the tree then a nil key
+// and value are returned. If the cursor has not yet been positioned
+// using First, Last, or Seek, then a nil key and value are returned.
+func (i *IteratorOf[V]) Next() ([]byte, V) {
+
+	return i.next().unpack()
+
+}
+
+// Seek moves the cursor to a given key in the tree and returns it.
+// If the specified key does not exist then the next key in the tree
+// is used. If no keys follow, then a nil key and value are returned.
+func (i *IteratorOf[V]) Seek(key []byte) ([]byte, V) {
+
+	return i.find(key).unpack()
+
+}
+
+// SeekGT moves the cursor to the first key in the tree which is
+// strictly greater than the given key and returns it. If no keys
+// follow, then a nil key and value are returned.
+func (i *IteratorOf[V]) SeekGT(key []byte) ([]byte, V) {
+
+	return i.seekGT(key).unpack()
+
+}
+
+// SeekLE moves the cursor to a given key in the tree and returns it.
+// If the specified key does not exist then the previous key in the
+// tree is used. If no keys precede, then a nil key and value are
+// returned.
+func (i *IteratorOf[V]) SeekLE(key []byte) ([]byte, V) {
+
+	return i.seekLE(key).unpack()
+
+}
+
+// SeekLT moves the cursor to the last key in the tree which is
+// strictly less than the given key and returns it. If no keys
+// precede, then a nil key and value are returned.
+func (i *IteratorOf[V]) SeekLT(key []byte) ([]byte, V) {
+
+	return i.seekLT(key).unpack()
+
+}
+
+// FirstOK moves the cursor to the first item in the tree and returns
+// its key and value, and whether an item was found.
+func (i *IteratorOf[V]) FirstOK() ([]byte, V, bool) {
+
+	i.path = nil
+
+	return i.first(i.root()).unpackOK()
+
+}
+
+// LastOK moves the cursor to the last item in the tree and returns
+// its key and value, and whether an item was found.
+func (i *IteratorOf[V]) LastOK() ([]byte, V, bool) {
+
+	i.path = nil
+
+	return i.last(i.root()).unpackOK()
+
+}
+
+// PrevOK moves the cursor to the previous item in the tree and returns
+// its key and value, and whether an item was found. This allows nil or
+// zero values to be distinguished from the start of the tree.
+func (i *IteratorOf[V]) PrevOK() ([]byte, V, bool) {
+
+	return i.prev().unpackOK()
+
+}
+
+// NextOK moves the cursor to the next item in the tree and returns its
+// key and value, and whether an item was found. This allows nil or zero
+// values to be distinguished from the end of the tree.
+func (i *IteratorOf[V]) NextOK() ([]byte, V, bool) {
+
+	return i.next().unpackOK()
+
+}
+
+// SeekOK moves the cursor to a given key in the tree and returns it,
+// and whether an item was found. If the specified key does not exist
+// then the next key in the tree is used.
+func (i *IteratorOf[V]) SeekOK(key []byte) ([]byte, V, bool) {
+
+	return i.find(key).unpackOK()
+
+}
+
+// ------
+
+func (i *IteratorOf[V]) prev() *leaf[V] {
+
+	// Reposition if the tree was changed
+	if len(i.path) > 0 && i.ver != i.tree.version() {
+		return i.seekLT(i.seek)
+	}
 
 OUTER:
 	for {
 
-		if len(c.path) == 0 {
+		if len(i.path) == 0 {
 			break
 		}
 
@@ -88,21 +218,21 @@ OUTER:
 
 		for {
 
-			x := len(c.path) - 1
+			x := len(i.path) - 1
 
-			if c.path[x].pos == 0 {
+			if i.path[x].pos == 0 {
 
-				c.path = c.path[:x]
+				i.path = i.path[:x]
 
-				if len(c.path) == 0 {
+				if len(i.path) == 0 {
 					break OUTER
 				}
 
-				n := c.node()
+				n := i.node()
 
 				if n.isLeaf() {
-					c.seek = n.leaf.key
-					return n.leaf.key, n.leaf.val
+					i.seek = n.leaf.key
+					return n.leaf
 				}
 
 				continue
@@ -119,25 +249,25 @@ OUTER:
 
 		for {
 
-			x := len(c.path) - 1
+			x := len(i.path) - 1
 
-			if c.path[x].pos-1 >= 0 {
+			if i.path[x].pos-1 >= 0 {
 
-				c.path[x].pos--
+				i.path[x].pos--
 
-				n := c.node()
+				n := i.node()
 
 				for {
 
 					if num := len(n.edges); num > 0 {
-						c.path = append(c.path, &item{pos: num - 1, node: n})
+						i.path = append(i.path, &item[V]{pos: num - 1, node: n})
 						n = n.edges[num-1]
 						continue
 					}
 
 					if n.isLeaf() {
-						c.seek = n.leaf.key
-						return n.leaf.key, n.leaf.val
+						i.seek = n.leaf.key
+						return n.leaf
 					}
 
 					continue OUTER
@@ -150,25 +280,25 @@ OUTER:
 
 	}
 
-	return nil, nil
+	return nil
 
 }
 
-// Next moves the cursor to the next item in the tree and returns its
-// key and value. If the tree is empty then a nil key and value are
-// returned, and if the cursor is at the end of the tree then a nil key
-// and value are returned. If the cursor has not yet been positioned
-// using First, Last, or Seek, then a nil key and value are returned.
-func (c *Cursor) Next() ([]byte, interface{}) {
+func (i *IteratorOf[V]) next() *leaf[V] {
+
+	// Reposition if the tree was changed
+	if len(i.path) > 0 && i.ver != i.tree.version() {
+		return i.seekGT(i.seek)
+	}
 
 OUTER:
 	for {
 
-		if len(c.path) == 0 {
+		if len(i.path) == 0 {
 			break
 		}
 
-		n := c.node()
+		n := i.node()
 
 		// ------------------------------
 		// Increase edges
@@ -178,12 +308,12 @@ OUTER:
 
 			if len(n.edges) > 0 {
 
-				c.path = append(c.path, &item{pos: 0, node: n})
+				i.path = append(i.path, &item[V]{pos: 0, node: n})
 				n = n.edges[0]
 
 				if n.isLeaf() {
-					c.seek = n.leaf.key
-					return n.leaf.key, n.leaf.val
+					i.seek = n.leaf.key
+					return n.leaf
 				}
 
 				continue
@@ -200,28 +330,28 @@ OUTER:
 
 		for {
 
-			if len(c.path) == 0 {
+			if len(i.path) == 0 {
 				break OUTER
 			}
 
-			x := len(c.path) - 1
+			x := len(i.path) - 1
 
-			if c.path[x].pos+1 < len(c.path[x].node.edges) {
+			if i.path[x].pos+1 < len(i.path[x].node.edges) {
 
-				c.path[x].pos++
+				i.path[x].pos++
 
-				n = c.node()
+				n = i.node()
 
 				if n.isLeaf() {
-					c.seek = n.leaf.key
-					return n.leaf.key, n.leaf.val
+					i.seek = n.leaf.key
+					return n.leaf
 				}
 
 				continue OUTER
 
 			} else {
 
-				c.path = c.path[:x]
+				i.path = i.path[:x]
 
 				continue
 
@@ -231,20 +361,17 @@ OUTER:
 
 	}
 
-	return nil, nil
+	return nil
 
 }
 
-// Seek moves the cursor to a given key in the tree and returns it.
-// If the specified key does not exist then the next key in the tree
-// is used. If no keys follow, then a nil key and value are returned.
-func (c *Cursor) Seek(key []byte) ([]byte, interface{}) {
+func (i *IteratorOf[V]) find(key []byte) *leaf[V] {
 
 	s := key
 
-	n := c.tree.root
+	n := i.root()
 
-	c.path = nil
+	i.path = nil
 
 	var x int
 
@@ -252,7 +379,7 @@ func (c *Cursor) Seek(key []byte) ([]byte, interface{}) {
 
 		// Check for key exhaution
 		if len(s) == 0 {
-			return c.first(n)
+			return i.first(n)
 		}
 
 		t := n
@@ -261,22 +388,17 @@ func (c *Cursor) Seek(key []byte) ([]byte, interface{}) {
 		if x, n = n.getSub(s[0]); n == nil {
 
 			if len(t.edges) == 0 {
-				return c.Next()
-			} else if s[0] < t.edges[0].prefix[0] {
-				if len(c.path) == 0 {
-					return c.first(c.tree.root)
-				}
-				return c.Next()
-			} else if s[0] > t.edges[len(t.edges)-1].prefix[0] {
-				if len(c.path) == 0 {
-					break
-				}
-				c.last(c.path[len(c.path)-1].node)
-				return c.Next()
+				return i.next()
+			} else if s[0] > t.labels[len(t.labels)-1] {
+				// Every key under this node sorts first
+				i.last(t)
+				return i.next()
 			} else {
+				// Move into the first edge after the key
 				for x, n = range t.edges {
 					if bytes.Compare(s, n.prefix) < 0 {
-						return c.first(n)
+						i.path = append(i.path, &item[V]{pos: x, node: t})
+						return i.first(n)
 					}
 				}
 			}
@@ -287,65 +409,159 @@ func (c *Cursor) Seek(key []byte) ([]byte, interface{}) {
 
 		// Consume the search prefix
 		if bytes.Compare(s, n.prefix) == 0 {
-			c.path = append(c.path, &item{pos: x, node: t})
+			i.path = append(i.path, &item[V]{pos: x, node: t})
 			s = s[:0]
 			continue
 		} else if bytes.HasPrefix(s, n.prefix) {
-			c.path = append(c.path, &item{pos: x, node: t})
+			i.path = append(i.path, &item[V]{pos: x, node: t})
 			s = s[len(n.prefix):]
 			continue
 		} else if bytes.HasPrefix(n.prefix, s) {
-			c.path = append(c.path, &item{pos: x, node: t})
+			i.path = append(i.path, &item[V]{pos: x, node: t})
 			s = s[:0]
 			continue
 		} else if bytes.Compare(s, n.prefix) < 0 {
-			c.path = append(c.path, &item{pos: x, node: t})
+			i.path = append(i.path, &item[V]{pos: x, node: t})
 			s = s[:0]
 			continue
 		} else if bytes.Compare(s, n.prefix) > 0 {
-			c.path = append(c.path, &item{pos: x, node: t})
-			c.last(n)
-			return c.Next()
+			i.path = append(i.path, &item[V]{pos: x, node: t})
+			i.last(n)
+			return i.next()
 		}
 
 		break
 
 	}
 
-	c.path = nil
+	i.path = nil
 
-	return nil, nil
+	return nil
 
 }
 
-// ------
+func (i *IteratorOf[V]) seekGT(key []byte) *leaf[V] {
 
-func (c *Cursor) node() *Node {
+	l := i.find(key)
 
-	var x int
+	if l != nil && bytes.Equal(l.key, key) {
+		return i.next()
+	}
+
+	return l
+
+}
+
+func (i *IteratorOf[V]) seekLE(key []byte) *leaf[V] {
+
+	l := i.find(key)
+
+	if l == nil {
+		i.path = nil
+		return i.last(i.root())
+	}
+
+	if bytes.Compare(l.key, key) > 0 {
+		return i.prev()
+	}
+
+	return l
+
+}
+
+func (i *IteratorOf[V]) seekLT(key []byte) *leaf[V] {
 
-	x = len(c.path) - 1
+	l := i.find(key)
 
-	if len(c.path[x].node.edges) <= c.path[x].pos {
-		c.Seek(c.seek)
-		x = len(c.path) - 1
+	if l == nil {
+		i.path = nil
+		return i.last(i.root())
 	}
 
-	return c.path[x].node.edges[c.path[x].pos]
+	return i.prev()
+
+}
+
+func (i *IteratorOf[V]) scan(start, end []byte, b Bounds, f WalkerOf[V]) {
+
+	var l *leaf[V]
+
+	i.path = nil
+
+	switch {
+	case start == nil:
+		l = i.first(i.root())
+	case b&IncludeStart == 0:
+		l = i.seekGT(start)
+	default:
+		l = i.find(start)
+	}
+
+	for ; l != nil; l = i.next() {
+		if end != nil {
+			if c := bytes.Compare(l.key, end); c > 0 || c == 0 && b&IncludeEnd == 0 {
+				return
+			}
+		}
+		if f(l.key, l.val) {
+			return
+		}
+	}
+
+}
+
+func (i *IteratorOf[V]) rscan(start, end []byte, b Bounds, f WalkerOf[V]) {
+
+	var l *leaf[V]
+
+	i.path = nil
+
+	switch {
+	case end == nil:
+		l = i.last(i.root())
+	case b&IncludeEnd == 0:
+		l = i.seekLT(end)
+	default:
+		l = i.seekLE(end)
+	}
+
+	for ; l != nil; l = i.prev() {
+		if start != nil {
+			if c := bytes.Compare(l.key, start); c < 0 || c == 0 && b&IncludeStart == 0 {
+				return
+			}
+		}
+		if f(l.key, l.val) {
+			return
+		}
+	}
+
+}
+
+func (i *IteratorOf[V]) root() *NodeOf[V] {
+	i.ver = i.tree.version()
+	return i.tree.top()
+}
+
+func (i *IteratorOf[V]) node() *NodeOf[V] {
+
+	x := len(i.path) - 1
+
+	return i.path[x].node.edges[i.path[x].pos]
 
 }
 
-func (c *Cursor) first(n *Node) ([]byte, interface{}) {
+func (i *IteratorOf[V]) first(n *NodeOf[V]) *leaf[V] {
 
 	for {
 
 		if n.isLeaf() {
-			c.seek = n.leaf.key
-			return n.leaf.key, n.leaf.val
+			i.seek = n.leaf.key
+			return n.leaf
 		}
 
 		if len(n.edges) > 0 {
-			c.path = append(c.path, &item{pos: 0, node: n})
+			i.path = append(i.path, &item[V]{pos: 0, node: n})
 			n = n.edges[0]
 		} else {
 			break
@@ -353,29 +569,29 @@ func (c *Cursor) first(n *Node) ([]byte, interface{}) {
 
 	}
 
-	return nil, nil
+	return nil
 
 }
 
-func (c *Cursor) last(n *Node) ([]byte, interface{}) {
+func (i *IteratorOf[V]) last(n *NodeOf[V]) *leaf[V] {
 
 	for {
 
 		if num := len(n.edges); num > 0 {
-			c.path = append(c.path, &item{pos: num - 1, node: n})
+			i.path = append(i.path, &item[V]{pos: num - 1, node: n})
 			n = n.edges[num-1]
 			continue
 		}
 
 		if n.isLeaf() {
-			c.seek = n.leaf.key
-			return n.leaf.key, n.leaf.val
+			i.seek = n.leaf.key
+			return n.leaf
 		}
 
 		break
 
 	}
 
-	return nil, nil
+	return nil
 
 }
@@ -0,0 +1,130 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+// Resolver is used when merging trees, and is called with each key
+// which was changed differently in both branches. A value is the zero
+// value if the key does not exist in that tree. The returned value is
+// stored, unless keep is false, in which case the key is deleted.
+type Resolver[V any] func(key []byte, base, a, b V) (val V, keep bool)
+
+// Combiner is used when combining two trees, and is called with each
+// key which exists in both trees, returning the value to be stored.
+type Combiner[V any] func(key []byte, a, b V) V
+
+// Merge performs a three-way merge of the trees a and b, which were
+// both derived from the base tree. Changes made in only one branch
+// are applied, and the function is called for any key which was
+// changed differently in both branches. The merge starts from tree a,
+// so any subtrees which were not changed in tree b are reused as is.
+func Merge[V any](base, a, b *TreeOf[V], f Resolver[V]) *TreeOf[V] {
+
+	if a.root == base.root {
+		return b
+	}
+
+	if b.root == base.root || b.root == a.root {
+		return a
+	}
+
+	c := a.Copy()
+
+	Diff(base, b, func(key []byte, _, _ V, _ ChangeKind) bool {
+
+		o := base.root.lookup(key)
+		x := a.root.lookup(key)
+		y := b.root.lookup(key)
+
+		switch {
+		case x == y:
+			// Both branches made the same change
+		case x == o:
+			// Only branch b changed this key
+			if y == nil {
+				c.Del(key)
+			} else {
+				c.Put(key, y.val)
+			}
+		default:
+			_, ov := o.unpack()
+			_, xv := x.unpack()
+			_, yv := y.unpack()
+			if v, keep := f(key, ov, xv, yv); keep {
+				c.Put(key, v)
+			} else {
+				c.Del(key)
+			}
+		}
+
+		return false
+
+	})
+
+	return c.Tree()
+
+}
+
+// Union returns a tree containing the keys which exist in either of
+// the trees a or b. The function is called for any key which exists
+// in both trees with different values. If the function is nil, then
+// the value from tree b is used.
+func Union[V any](a, b *TreeOf[V], f Combiner[V]) *TreeOf[V] {
+
+	c := a.Copy()
+
+	Diff(a, b, func(key []byte, x, y V, kind ChangeKind) bool {
+		switch kind {
+		case Insert:
+			c.Put(key, y)
+		case Update:
+			c.Put(key, combine(f, key, x, y))
+		}
+		return false
+	})
+
+	return c.Tree()
+
+}
+
+// Intersection returns a tree containing the keys which exist in both
+// of the trees a and b. The function is called for any key which has
+// different values in each tree. If the function is nil, then the
+// value from tree b is used.
+func Intersection[V any](a, b *TreeOf[V], f Combiner[V]) *TreeOf[V] {
+
+	c := a.Copy()
+
+	Diff(a, b, func(key []byte, x, y V, kind ChangeKind) bool {
+		switch kind {
+		case Delete:
+			c.Del(key)
+		case Update:
+			c.Put(key, combine(f, key, x, y))
+		}
+		return false
+	})
+
+	return c.Tree()
+
+}
+
+// ---------------------------------------------------------------------------
+
+func combine[V any](f Combiner[V], key []byte, a, b V) V {
+	if f == nil {
+		return b
+	}
+	return f(key, a, b)
+}
@@ -0,0 +1,120 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func dump[V any](t *TreeOf[V]) (out []string) {
+	t.Walk(nil, func(key []byte, val V) bool {
+		out = append(out, fmt.Sprintf("%s=%v", key, val))
+		return false
+	})
+	return
+}
+
+func TestMerge(t *testing.T) {
+
+	c := NewTree[int]().Copy()
+	c.Put([]byte("/a"), 1)
+	c.Put([]byte("/b"), 2)
+	c.Put([]byte("/c"), 3)
+	c.Put([]byte("/d"), 4)
+	c.Put([]byte("/e"), 5)
+	base := c.Tree()
+
+	sum := func(key []byte, base, a, b int) (int, bool) {
+		return a + b, true
+	}
+
+	Convey("Unchanged branches are returned as is", t, func() {
+		c := base.Copy()
+		c.Put([]byte("/f"), 6)
+		a := c.Tree()
+		So(Merge(base, a, base, sum), ShouldEqual, a)
+		So(Merge(base, base, a, sum), ShouldEqual, a)
+	})
+
+	Convey("Can merge changes from both branches", t, func() {
+		x := base.Copy()
+		x.Put([]byte("/a"), 10)
+		x.Del([]byte("/b"))
+		x.Put([]byte("/f"), 60)
+		x.Put([]byte("/e"), 50)
+		y := base.Copy()
+		y.Put([]byte("/c"), 30)
+		y.Del([]byte("/d"))
+		y.Put([]byte("/g"), 70)
+		y.Del([]byte("/e"))
+		a, b := x.Tree(), y.Tree()
+		var conflicts []string
+		m := Merge(base, a, b, func(key []byte, o, x, y int) (int, bool) {
+			conflicts = append(conflicts, fmt.Sprintf("%s %d %d %d", key, o, x, y))
+			return x, true
+		})
+		So(conflicts, ShouldResemble, []string{"/e 5 50 0"})
+		So(dump(m), ShouldResemble, []string{
+			"/a=10", "/c=30", "/e=50", "/f=60", "/g=70",
+		})
+		So(dump(base), ShouldHaveLength, 5)
+	})
+
+	Convey("Can resolve conflicts by deleting keys", t, func() {
+		x := base.Copy()
+		x.Put([]byte("/a"), 10)
+		x.Del([]byte("/b"))
+		y := base.Copy()
+		y.Put([]byte("/a"), 100)
+		y.Del([]byte("/b"))
+		m := Merge(base, x.Tree(), y.Tree(), func(key []byte, o, x, y int) (int, bool) {
+			return 0, false
+		})
+		So(dump(m), ShouldResemble, []string{"/c=3", "/d=4", "/e=5"})
+	})
+
+	Convey("Can take the union of two trees", t, func() {
+		x := NewTree[int]().Copy()
+		x.Put([]byte("/a"), 1)
+		x.Put([]byte("/b"), 2)
+		y := NewTree[int]().Copy()
+		y.Put([]byte("/b"), 20)
+		y.Put([]byte("/c"), 30)
+		a, b := x.Tree(), y.Tree()
+		So(dump(Union(a, b, nil)), ShouldResemble, []string{"/a=1", "/b=20", "/c=30"})
+		So(dump(Union(a, b, func(key []byte, a, b int) int {
+			return a + b
+		})), ShouldResemble, []string{"/a=1", "/b=22", "/c=30"})
+	})
+
+	Convey("Can take the intersection of two trees", t, func() {
+		x := NewTree[int]().Copy()
+		x.Put([]byte("/a"), 1)
+		x.Put([]byte("/b"), 2)
+		y := NewTree[int]().Copy()
+		y.Put([]byte("/b"), 20)
+		y.Put([]byte("/c"), 30)
+		a, b := x.Tree(), y.Tree()
+		So(dump(Intersection(a, b, nil)), ShouldResemble, []string{"/b=20"})
+		So(dump(Intersection(a, b, func(key []byte, a, b int) int {
+			return a
+		})), ShouldResemble, []string{"/b=2"})
+		So(Intersection(a, b, nil).Size(), ShouldEqual, 1)
+	})
+
+}
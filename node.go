@@ -16,25 +16,83 @@ package ptree
 
 import (
 	"bytes"
-	"sort"
+	"sync/atomic"
 )
 
-// Node represents an immutable node in the radix tree which
+// stale is a closed channel which is used as the watch channel
+// of any nodes which have already been replaced.
+var stale = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+const (
+	// smallEdges is the number of edges up to which the labels of a
+	// node are scanned in order, rather than using a binary search,
+	// as scanning a few bytes is faster than the extra branches.
+	smallEdges = 16
+	// denseEdges is the number of edges above which a node keeps a
+	// direct index of the edge positions, for each of the 256 possible
+	// labels, in addition to searching the sorted edge labels.
+	denseEdges = 48
+	// sparseEdges is the number of edges at which a node drops its
+	// direct index, which is lower than the point at which the index
+	// is added, so that nodes which are near the threshold do not
+	// keep switching back and forth.
+	sparseEdges = 36
+)
+
+// NodeOf represents an immutable node in the radix tree which
 // can be either an edge node or a leaf node.
-type Node struct {
-	leaf   *leaf
-	edges  []*Node
+type NodeOf[V any] struct {
+	leaf   *leaf[V]
+	edges  []*NodeOf[V]
+	labels []byte
+	index  *[256]uint16
 	prefix []byte
+	count  int
+	sum    any
+	hash   []byte
+	watch  atomic.Pointer[chan struct{}]
+	owner  *owner
+}
+
+// Node is a node in a tree which holds values of any type.
+type Node = NodeOf[any]
+
+// owner identifies the copy which created a node, so that the copy
+// can modify the node in place. It is not empty, so that every owner
+// is allocated at a distinct address.
+type owner struct {
+	_ byte
 }
 
-type leaf struct {
+// leaf represents a key-value pair stored in the radix tree. Leaves
+// are never modified once created, so they can be shared between
+// any nodes and trees.
+type leaf[V any] struct {
 	key []byte
-	val interface{}
+	val V
+}
+
+func (l *leaf[V]) unpack() (key []byte, val V) {
+	if l != nil {
+		return l.key, l.val
+	}
+	return
+}
+
+func (l *leaf[V]) unpackOK() (key []byte, val V, ok bool) {
+	if l != nil {
+		return l.key, l.val, true
+	}
+	return
 }
 
 // Min returns the key and value of the minimum item in the
 // subtree of the current node.
-func (n *Node) Min() ([]byte, interface{}) {
+func (n *NodeOf[V]) Min() (key []byte, val V) {
 
 	for {
 
@@ -50,13 +108,13 @@ func (n *Node) Min() ([]byte, interface{}) {
 
 	}
 
-	return nil, nil
+	return
 
 }
 
 // Max returns the key and value of the maximum item in the
 // subtree of the current node.
-func (n *Node) Max() ([]byte, interface{}) {
+func (n *NodeOf[V]) Max() (key []byte, val V) {
 
 	for {
 
@@ -73,13 +131,34 @@ func (n *Node) Max() ([]byte, interface{}) {
 
 	}
 
-	return nil, nil
+	return
+
+}
+
+// Watch returns a channel which is closed when this node, or any
+// node under it, is replaced by a committed Copy. Only copies which
+// have been configured using Notify will close watch channels.
+func (n *NodeOf[V]) Watch() <-chan struct{} {
+
+	for {
+
+		if ch := n.watch.Load(); ch != nil {
+			return *ch
+		}
+
+		ch := make(chan struct{})
+
+		if n.watch.CompareAndSwap(nil, &ch) {
+			return ch
+		}
+
+	}
 
 }
 
 // Path is used to recurse over the tree only visiting nodes
 // which are above this node in the tree.
-func (n *Node) Path(key []byte, f Walker) {
+func (n *NodeOf[V]) Path(key []byte, f WalkerOf[V]) {
 
 	s := key
 
@@ -109,7 +188,7 @@ func (n *Node) Path(key []byte, f Walker) {
 
 // Subs is used to recurse over the tree only visiting nodes
 // which are directly under this node in the tree.
-func (n *Node) Subs(key []byte, f Walker) {
+func (n *NodeOf[V]) Subs(key []byte, f WalkerOf[V]) {
 
 	s := key
 
@@ -142,7 +221,7 @@ func (n *Node) Subs(key []byte, f Walker) {
 
 // Walk is used to recurse over the tree only visiting nodes
 // which are under this node in the tree.
-func (n *Node) Walk(key []byte, f Walker) {
+func (n *NodeOf[V]) Walk(key []byte, f WalkerOf[V]) {
 
 	s := key
 
@@ -173,99 +252,200 @@ func (n *Node) Walk(key []byte, f Walker) {
 
 }
 
+// LongestPrefix returns the key and value of the longest key in the
+// subtree of this node which is a prefix of the specified key, and
+// whether any such key exists.
+func (n *NodeOf[V]) LongestPrefix(key []byte) ([]byte, V, bool) {
+	return n.match(key).unpackOK()
+}
+
 // ------------------------------
 // ------------------------------
 // ------------------------------
 // ------------------------------
 // ------------------------------
 
-func (n *Node) isLeaf() bool {
+func (n *NodeOf[V]) isLeaf() bool {
 	return n.leaf != nil
 }
 
-func (n *Node) dup() *Node {
-	d := &Node{}
+func (n *NodeOf[V]) notify() {
+	if ch := n.watch.Swap(&stale); ch != nil && ch != &stale {
+		close(*ch)
+	}
+}
+
+// notifyAll closes the watch channels of every node within a subtree
+// which has been removed from the tree.
+func (n *NodeOf[V]) notifyAll() {
+	n.notify()
+	for _, e := range n.edges {
+		e.notifyAll()
+	}
+}
+
+// update recalculates the aggregated summary of this node if there is
+// an aggregator, and the hash if there is a hasher, once its leaf or
+// edges have been modified. The number of keys is adjusted by each
+// change as it is made, so that only the changed path is visited.
+func (n *NodeOf[V]) update(a aggregator[V], h Hasher[V]) {
+	if a != nil {
+		n.sum = a.node(n)
+	}
+	if h != nil {
+		n.hash = digest(n, h)
+	}
+}
+
+// recount recalculates the number of keys within the subtree of this
+// node from its leaf and edges, when the node is built from scratch.
+func (n *NodeOf[V]) recount() {
+	n.count = 0
 	if n.leaf != nil {
-		d.leaf = &leaf{}
-		*d.leaf = *n.leaf
+		n.count++
 	}
-	if n.prefix != nil {
-		d.prefix = make([]byte, len(n.prefix))
-		copy(d.prefix, n.prefix)
+	for _, e := range n.edges {
+		n.count += e.count
 	}
+}
+
+func (n *NodeOf[V]) dup() *NodeOf[V] {
+	d := &NodeOf[V]{leaf: n.leaf, prefix: n.prefix, count: n.count, sum: n.sum, hash: n.hash}
+	d.copyEdges(n)
+	return d
+}
+
+// copyEdges replaces the edges of this node with a copy of the edges
+// of the other node, along with its layout.
+func (n *NodeOf[V]) copyEdges(o *NodeOf[V]) {
+	n.edges, n.labels, n.index = nil, nil, nil
+	if len(o.edges) != 0 {
+		n.edges = make([]*NodeOf[V], len(o.edges))
+		copy(n.edges, o.edges)
+	}
+	if o.labels != nil {
+		n.labels = make([]byte, len(o.labels))
+		copy(n.labels, o.labels)
+	}
+	if o.index != nil {
+		i := *o.index
+		n.index = &i
+	}
+}
+
+// layout rebuilds the labels of this node from its edges, along with
+// a direct index for nodes with many edges.
+func (n *NodeOf[V]) layout() {
+	n.labels, n.index = nil, nil
 	if len(n.edges) != 0 {
-		d.edges = make([]*Node, len(n.edges))
-		copy(d.edges, n.edges)
+		n.labels = make([]byte, len(n.edges))
+		for i, e := range n.edges {
+			n.labels[i] = e.prefix[0]
+		}
+	}
+	if len(n.edges) > denseEdges {
+		n.index = new([256]uint16)
+		n.reindex(0)
 	}
-	return d
 }
 
-func (n *Node) addSub(s *Node) {
-	num := len(n.edges)
-	idx := sort.Search(num, func(i int) bool {
-		return n.edges[i].prefix[0] >= s.prefix[0]
-	})
-	n.edges = append(n.edges, s)
-	if idx != num {
-		copy(n.edges[idx+1:], n.edges[idx:num])
-		n.edges[idx] = s
+// reindex updates the direct index for the edges from the position
+// onwards, once they have been moved.
+func (n *NodeOf[V]) reindex(from int) {
+	for i := from; i < len(n.labels); i++ {
+		n.index[n.labels[i]] = uint16(i + 1)
+	}
+}
+
+// search returns the position of the edge with the label, or the
+// position at which such an edge would be inserted, and whether the
+// edge exists within this node.
+func (n *NodeOf[V]) search(label byte) (int, bool) {
+	if n.index != nil {
+		if i := n.index[label]; i != 0 {
+			return int(i) - 1, true
+		}
 	}
+	lo, hi := 0, len(n.labels)
+	if hi <= smallEdges {
+		for lo < hi && n.labels[lo] < label {
+			lo++
+		}
+		return lo, n.index == nil && lo < len(n.labels) && n.labels[lo] == label
+	}
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+		if n.labels[m] < label {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
+	return lo, n.index == nil && lo < len(n.labels) && n.labels[lo] == label
 }
 
-func (n *Node) repSub(s *Node) {
-	num := len(n.edges)
-	idx := sort.Search(num, func(i int) bool {
-		return n.edges[i].prefix[0] >= s.prefix[0]
-	})
-	if idx < num && n.edges[idx].prefix[0] == s.prefix[0] {
+func (n *NodeOf[V]) addSub(s *NodeOf[V]) {
+	idx, _ := n.search(s.prefix[0])
+	n.edges = append(n.edges, nil)
+	copy(n.edges[idx+1:], n.edges[idx:])
+	n.edges[idx] = s
+	n.labels = append(n.labels, 0)
+	copy(n.labels[idx+1:], n.labels[idx:])
+	n.labels[idx] = s.prefix[0]
+	switch {
+	case n.index != nil:
+		n.reindex(idx)
+	case len(n.edges) > denseEdges:
+		n.layout()
+	}
+}
+
+func (n *NodeOf[V]) repSub(s *NodeOf[V]) {
+	if idx, ok := n.search(s.prefix[0]); ok {
 		n.edges[idx] = s
 		return
 	}
 	panic("replacing missing edge")
 }
 
-func (n *Node) getSub(label byte) (int, *Node) {
-	num := len(n.edges)
-	idx := sort.Search(num, func(i int) bool {
-		return n.edges[i].prefix[0] >= label
-	})
-	if idx < num && n.edges[idx].prefix[0] == label {
+func (n *NodeOf[V]) getSub(label byte) (int, *NodeOf[V]) {
+	if idx, ok := n.search(label); ok {
 		return idx, n.edges[idx]
 	}
 	return -1, nil
 }
 
-func (n *Node) delSub(label byte) {
-	num := len(n.edges)
-	idx := sort.Search(num, func(i int) bool {
-		return n.edges[i].prefix[0] >= label
-	})
-	if idx < num && n.edges[idx].prefix[0] == label {
-		copy(n.edges[idx:], n.edges[idx+1:])
-		n.edges[len(n.edges)-1] = nil
-		n.edges = n.edges[:len(n.edges)-1]
+func (n *NodeOf[V]) delSub(label byte) {
+	idx, ok := n.search(label)
+	if !ok {
+		return
+	}
+	copy(n.edges[idx:], n.edges[idx+1:])
+	n.edges[len(n.edges)-1] = nil
+	n.edges = n.edges[:len(n.edges)-1]
+	copy(n.labels[idx:], n.labels[idx+1:])
+	n.labels = n.labels[:len(n.labels)-1]
+	switch {
+	case n.index != nil && len(n.edges) <= sparseEdges:
+		n.index = nil
+	case n.index != nil:
+		n.index[label] = 0
+		n.reindex(idx)
 	}
 }
 
-func (n *Node) mergeChild() {
+func (n *NodeOf[V]) mergeChild() {
 	e := n.edges[0]
 	child := e
 	n.prefix = concat(n.prefix, child.prefix)
-	if child.leaf != nil {
-		n.leaf = new(leaf)
-		*n.leaf = *child.leaf
-	} else {
-		n.leaf = nil
-	}
-	if len(child.edges) != 0 {
-		n.edges = make([]*Node, len(child.edges))
-		copy(n.edges, child.edges)
-	} else {
-		n.edges = nil
-	}
+	n.leaf = child.leaf
+	n.count = child.count
+	n.sum = child.sum
+	n.hash = child.hash
+	n.copyEdges(child)
 }
 
-func subs(n *Node, f Walker, sub bool) bool {
+func subs[V any](n *NodeOf[V], f WalkerOf[V], sub bool) bool {
 
 	// Visit the leaf values if any
 	if sub && n.leaf != nil {
@@ -286,7 +466,7 @@ func subs(n *Node, f Walker, sub bool) bool {
 
 }
 
-func walk(n *Node, f Walker, sub bool) bool {
+func walk[V any](n *NodeOf[V], f WalkerOf[V], sub bool) bool {
 
 	// Visit the leaf values if any
 	if n.leaf != nil {
@@ -306,7 +486,7 @@ func walk(n *Node, f Walker, sub bool) bool {
 
 }
 
-func (n *Node) get(k []byte) interface{} {
+func (n *NodeOf[V]) cover(k []byte) *NodeOf[V] {
 
 	s := k
 
@@ -314,27 +494,125 @@ func (n *Node) get(k []byte) interface{} {
 
 		// Check for key exhaution
 		if len(s) == 0 {
-			if n.isLeaf() {
-				return n.leaf.val
-			}
-			break
+			return n
+		}
+
+		// Look for an edge
+		_, e := n.getSub(s[0])
+		if e == nil {
+			return n
+		}
+
+		// Consume the search prefix
+		if bytes.HasPrefix(s, e.prefix) {
+			s = s[len(e.prefix):]
+			n = e
+		} else if bytes.HasPrefix(e.prefix, s) {
+			return e
+		} else {
+			return n
+		}
+
+	}
+
+}
+
+// under returns the node whose subtree contains exactly the keys
+// which start with the prefix, or nil if there are no such keys.
+func (n *NodeOf[V]) under(k []byte) *NodeOf[V] {
+
+	s := k
+
+	for {
+
+		// Check for key exhaution
+		if len(s) == 0 {
+			return n
+		}
+
+		// Look for an edge
+		if _, n = n.getSub(s[0]); n == nil {
+			return nil
+		}
+
+		// Consume the search prefix
+		if bytes.HasPrefix(s, n.prefix) {
+			s = s[len(n.prefix):]
+		} else if bytes.HasPrefix(n.prefix, s) {
+			return n
+		} else {
+			return nil
+		}
+
+	}
+
+}
+
+func (n *NodeOf[V]) get(k []byte) (val V, ok bool) {
+	if l := n.lookup(k); l != nil {
+		return l.val, true
+	}
+	return
+}
+
+func (n *NodeOf[V]) lookup(k []byte) *leaf[V] {
+
+	s := k
+
+	for {
+
+		// Check for key exhaution
+		if len(s) == 0 {
+			return n.leaf
 		}
 
 		// Look for an edge
 		_, n = n.getSub(s[0])
 		if n == nil {
-			break
+			return nil
 		}
 
 		// Consume the search prefix
 		if bytes.HasPrefix(s, n.prefix) {
 			s = s[len(n.prefix):]
 		} else {
-			break
+			return nil
 		}
 
 	}
 
-	return nil
+}
+
+// match returns the leaf with the longest key which is a prefix of
+// the specified key, or nil if there is no such leaf.
+func (n *NodeOf[V]) match(k []byte) (l *leaf[V]) {
+
+	s := k
+
+	for {
+
+		// Keep the deepest leaf so far
+		if n.isLeaf() {
+			l = n.leaf
+		}
+
+		// Check for key exhaution
+		if len(s) == 0 {
+			return
+		}
+
+		// Look for an edge
+		if _, n = n.getSub(s[0]); n == nil {
+			return
+		}
+
+		// Consume the search prefix
+		if bytes.HasPrefix(s, n.prefix) {
+			s = s[len(n.prefix):]
+		} else {
+			return
+		}
+
+	}
 
 }
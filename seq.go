@@ -0,0 +1,185 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"bytes"
+	"iter"
+)
+
+// All returns an iterator over every key and value in the tree,
+// in ascending order.
+func (t *TreeOf[V]) All() iter.Seq2[[]byte, V] {
+	return t.root.Prefix(nil)
+}
+
+// Backward returns an iterator over every key and value in the
+// tree, in descending order.
+func (t *TreeOf[V]) Backward() iter.Seq2[[]byte, V] {
+	return seq(func(f WalkerOf[V]) {
+		t.ReverseRange(nil, nil, f)
+	})
+}
+
+// Prefix returns an iterator over the keys and values in the tree
+// which are under the specified key, in ascending order.
+func (t *TreeOf[V]) Prefix(key []byte) iter.Seq2[[]byte, V] {
+	return t.root.Prefix(key)
+}
+
+// Children returns an iterator over the keys and values in the tree
+// which are directly under the specified key, in ascending order.
+func (t *TreeOf[V]) Children(key []byte) iter.Seq2[[]byte, V] {
+	return t.root.Children(key)
+}
+
+// Ancestors returns an iterator over the keys and values in the tree
+// which are above the specified key, starting from the shortest key.
+func (t *TreeOf[V]) Ancestors(key []byte) iter.Seq2[[]byte, V] {
+	return t.root.Ancestors(key)
+}
+
+// Between returns an iterator over the keys and values in the tree
+// between the start and end keys, as set out by Bounds, in ascending
+// order. It is named Between, as Range already iterates over the same
+// keys using a callback function.
+func (t *TreeOf[V]) Between(start, end []byte, b ...Bounds) iter.Seq2[[]byte, V] {
+	return seq(func(f WalkerOf[V]) {
+		t.Range(start, end, f, b...)
+	})
+}
+
+// All returns an iterator over every key and value in the tree,
+// in ascending order.
+func (c *CopyOf[V]) All() iter.Seq2[[]byte, V] {
+	return c.Prefix(nil)
+}
+
+// Backward returns an iterator over every key and value in the
+// tree, in descending order.
+func (c *CopyOf[V]) Backward() iter.Seq2[[]byte, V] {
+	return seq(func(f WalkerOf[V]) {
+		c.ReverseRange(nil, nil, f)
+	})
+}
+
+// Prefix returns an iterator over the keys and values in the tree
+// which are under the specified key, in ascending order.
+func (c *CopyOf[V]) Prefix(key []byte) iter.Seq2[[]byte, V] {
+	return c.visit(func(n *NodeOf[V], f WalkerOf[V]) {
+		n.Walk(key, f)
+	}, func(last []byte, f WalkerOf[V]) {
+		i := c.Cursor()
+		for l := i.seekGT(last); l != nil && bytes.HasPrefix(l.key, key); l = i.next() {
+			if f(l.key, l.val) {
+				return
+			}
+		}
+	})
+}
+
+// Children returns an iterator over the keys and values in the tree
+// which are directly under the specified key, in ascending order.
+func (c *CopyOf[V]) Children(key []byte) iter.Seq2[[]byte, V] {
+	return c.visit(func(n *NodeOf[V], f WalkerOf[V]) {
+		n.Subs(key, f)
+	}, nil)
+}
+
+// Ancestors returns an iterator over the keys and values in the tree
+// which are above the specified key, starting from the shortest key.
+func (c *CopyOf[V]) Ancestors(key []byte) iter.Seq2[[]byte, V] {
+	return c.visit(func(n *NodeOf[V], f WalkerOf[V]) {
+		n.Path(key, f)
+	}, nil)
+}
+
+// Between returns an iterator over the keys and values in the tree
+// between the start and end keys, as set out by Bounds, in ascending
+// order.
+func (c *CopyOf[V]) Between(start, end []byte, b ...Bounds) iter.Seq2[[]byte, V] {
+	return seq(func(f WalkerOf[V]) {
+		c.Range(start, end, f, b...)
+	})
+}
+
+// Prefix returns an iterator over the keys and values which are
+// under the specified key in the subtree of this node.
+func (n *NodeOf[V]) Prefix(key []byte) iter.Seq2[[]byte, V] {
+	return seq(func(f WalkerOf[V]) {
+		n.Walk(key, f)
+	})
+}
+
+// Children returns an iterator over the keys and values which are
+// directly under the specified key in the subtree of this node.
+func (n *NodeOf[V]) Children(key []byte) iter.Seq2[[]byte, V] {
+	return seq(func(f WalkerOf[V]) {
+		n.Subs(key, f)
+	})
+}
+
+// Ancestors returns an iterator over the keys and values which are
+// above the specified key in the subtree of this node.
+func (n *NodeOf[V]) Ancestors(key []byte) iter.Seq2[[]byte, V] {
+	return seq(func(f WalkerOf[V]) {
+		n.Path(key, f)
+	})
+}
+
+// ---------------------------------------------------------------------------
+
+// visit adapts a walk over the root of this copy into an iterator.
+// The root is only read once the loop starts. If the loop body
+// changes the copy, the walk stops before reading any more nodes,
+// and is continued after the last key which was visited, either by
+// resume, or by walking again from the new root. The walk must visit
+// the keys in ascending order.
+func (c *CopyOf[V]) visit(walk func(*NodeOf[V], WalkerOf[V]), resume func([]byte, WalkerOf[V])) iter.Seq2[[]byte, V] {
+	return seq(func(f WalkerOf[V]) {
+		var last []byte
+		seen := false
+		for {
+			ver, exit := c.version(), false
+			walk(c.top(), func(key []byte, val V) bool {
+				if seen && bytes.Compare(key, last) <= 0 {
+					return false
+				}
+				if exit = f(key, val); exit {
+					return true
+				}
+				last, seen = key, true
+				return c.version() != ver
+			})
+			if exit || c.version() == ver {
+				return
+			}
+			if resume != nil {
+				resume(last, f)
+				return
+			}
+		}
+	})
+}
+
+// seq adapts a callback based iteration into an iterator, stopping
+// the iteration when the loop body exits.
+func seq[V any](fn func(WalkerOf[V])) iter.Seq2[[]byte, V] {
+	return func(yield func([]byte, V) bool) {
+		fn(func(key []byte, val V) bool {
+			return !yield(key, val)
+		})
+	}
+}
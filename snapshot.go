@@ -0,0 +1,376 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	snapshotVersion = 1
+	snapshotHasLeaf = 1 << 0
+	// Every node below the root adds at least one byte to the keys
+	// beneath it, so a tree this deep would need keys which branch
+	// at each of 64KiB bytes. Limiting the depth stops a malformed
+	// snapshot from nesting nodes until the stack is exhausted.
+	snapshotMaxDepth = 1 << 16
+)
+
+var snapshotMagic = [4]byte{'P', 'T', 'R', 'E'}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrCorrupt is returned when reading a snapshot which is
+	// malformed, or which does not match its checksum.
+	ErrCorrupt = errors.New("ptree: corrupt snapshot")
+	// ErrVersion is returned when reading a snapshot which was
+	// written using an unsupported version of the format.
+	ErrVersion = errors.New("ptree: unsupported snapshot version")
+)
+
+// Codec is used to encode and decode the values stored within a
+// tree, when writing and reading snapshots.
+type Codec[V any] interface {
+	Encode(val V) ([]byte, error)
+	Decode(data []byte) (V, error)
+}
+
+// BytesCodec is a Codec which stores byte slice values as is.
+type BytesCodec struct{}
+
+// Encode returns the value as is.
+func (BytesCodec) Encode(val []byte) ([]byte, error) {
+	return val, nil
+}
+
+// Decode returns a copy of the data.
+func (BytesCodec) Decode(data []byte) ([]byte, error) {
+	return append([]byte(nil), data...), nil
+}
+
+// Snapshot is used to write a tree to, and read a tree from, a
+// binary stream. The stream contains a versioned header, followed
+// by the nodes of the tree, and a checksum of the whole stream.
+// A Tree does not implement io.WriterTo and io.ReaderFrom itself,
+// as the values need a codec, and as a tree is immutable, so can
+// not be replaced in place by ReadFrom. A Snapshot pairs the tree
+// with the codec, and holds the tree which was read.
+type Snapshot[V any] struct {
+	tree  *TreeOf[V]
+	codec Codec[V]
+}
+
+// NewSnapshot returns an empty Snapshot, which can be used to read
+// a tree from a stream, using the codec to decode the values. Any
+// tree which is read is configured using the specified options.
+func NewSnapshot[V any](c Codec[V], opts ...Option[V]) *Snapshot[V] {
+	return &Snapshot[V]{tree: NewTree[V](opts...), codec: c}
+}
+
+// Snapshot returns a Snapshot which can be used to write this tree
+// to a stream, using the codec to encode the values.
+func (t *TreeOf[V]) Snapshot(c Codec[V]) *Snapshot[V] {
+	return &Snapshot[V]{tree: t, codec: c}
+}
+
+// Tree returns the tree held within this snapshot.
+func (s *Snapshot[V]) Tree() *TreeOf[V] {
+	return s.tree
+}
+
+// WriteTo writes the tree to the writer, returning the number of
+// bytes which were written.
+func (s *Snapshot[V]) WriteTo(w io.Writer) (int64, error) {
+
+	cw := &checkWriter{w: w, h: crc32.New(castagnoli)}
+	bw := bufio.NewWriter(cw)
+
+	bw.Write(snapshotMagic[:])
+	bw.WriteByte(snapshotVersion)
+	writeUvarint(bw, uint64(s.tree.size))
+
+	if err := s.encode(bw, s.tree.root); err != nil {
+		return cw.n, err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return cw.n, err
+	}
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], cw.h.Sum32())
+	n, err := w.Write(sum[:])
+
+	return cw.n + int64(n), err
+
+}
+
+// ReadFrom reads a tree from the reader, replacing the tree held
+// within this snapshot, and returning the number of bytes which
+// were read. The tree is only replaced if it was read successfully,
+// and keeps the configuration of the tree which it replaces.
+// If the reader does not implement io.ByteReader, then it will be
+// buffered, and so may be read beyond the end of the snapshot.
+func (s *Snapshot[V]) ReadFrom(r io.Reader) (int64, error) {
+
+	br, ok := r.(byteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	cr := &checkReader{r: br, h: crc32.New(castagnoli)}
+
+	var head [5]byte
+	if _, err := io.ReadFull(cr, head[:]); err != nil {
+		return cr.n, corrupt(err)
+	}
+
+	if !bytes.Equal(head[:4], snapshotMagic[:]) {
+		return cr.n, ErrCorrupt
+	}
+
+	if head[4] != snapshotVersion {
+		return cr.n, ErrVersion
+	}
+
+	size, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return cr.n, corrupt(err)
+	}
+
+	d := &decoder[V]{r: cr, codec: s.codec, agg: s.tree.agg, hash: s.tree.hash}
+
+	root, err := d.decode(nil, 0)
+	if err != nil {
+		return cr.n, err
+	}
+
+	if d.size != size {
+		return cr.n, ErrCorrupt
+	}
+
+	exp := cr.h.Sum32()
+
+	var sum [4]byte
+	if _, err := io.ReadFull(cr, sum[:]); err != nil {
+		return cr.n, corrupt(err)
+	}
+
+	if binary.BigEndian.Uint32(sum[:]) != exp {
+		return cr.n, ErrCorrupt
+	}
+
+	s.tree = &TreeOf[V]{size: int(size), root: root, agg: s.tree.agg, hash: s.tree.hash, subs: s.tree.subs}
+
+	return cr.n, nil
+
+}
+
+// ---------------------------------------------------------------------------
+
+func corrupt(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrCorrupt
+	}
+	return err
+}
+
+func writeUvarint(w *bufio.Writer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	w.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func (s *Snapshot[V]) encode(w *bufio.Writer, n *NodeOf[V]) error {
+
+	writeUvarint(w, uint64(len(n.prefix)))
+	w.Write(n.prefix)
+
+	if n.isLeaf() {
+		val, err := s.codec.Encode(n.leaf.val)
+		if err != nil {
+			return err
+		}
+		w.WriteByte(snapshotHasLeaf)
+		writeUvarint(w, uint64(len(val)))
+		w.Write(val)
+	} else {
+		w.WriteByte(0)
+	}
+
+	writeUvarint(w, uint64(len(n.edges)))
+
+	for _, e := range n.edges {
+		if err := s.encode(w, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+type decoder[V any] struct {
+	r     *checkReader
+	codec Codec[V]
+	agg   aggregator[V]
+	hash  Hasher[V]
+	size  uint64
+}
+
+func (d *decoder[V]) bytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, corrupt(err)
+	}
+	// Don't trust large lengths before the data has been read
+	if n > 1<<16 {
+		var b bytes.Buffer
+		if _, err := io.CopyN(&b, d.r, int64(n)); err != nil {
+			return nil, corrupt(err)
+		}
+		return b.Bytes(), nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return nil, corrupt(err)
+	}
+	return b, nil
+}
+
+func (d *decoder[V]) decode(path []byte, depth int) (*NodeOf[V], error) {
+
+	if depth > snapshotMaxDepth {
+		return nil, ErrCorrupt
+	}
+
+	root := depth == 0
+
+	n := &NodeOf[V]{}
+
+	prefix, err := d.bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(prefix) == 0 && !root {
+		return nil, ErrCorrupt
+	}
+
+	if len(prefix) > 0 {
+		n.prefix = prefix
+	}
+
+	path = append(path, prefix...)
+
+	flags, err := d.r.ReadByte()
+	if err != nil {
+		return nil, corrupt(err)
+	}
+
+	if flags&snapshotHasLeaf != 0 {
+		data, err := d.bytes()
+		if err != nil {
+			return nil, err
+		}
+		val, err := d.codec.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+		n.leaf = &leaf[V]{key: append([]byte(nil), path...), val: val}
+		d.size++
+	}
+
+	num, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, corrupt(err)
+	}
+
+	if num > 256 {
+		return nil, ErrCorrupt
+	}
+
+	if num > 0 {
+		n.edges = make([]*NodeOf[V], num)
+	}
+
+	for i := range n.edges {
+		if n.edges[i], err = d.decode(path, depth+1); err != nil {
+			return nil, err
+		}
+		if i > 0 && n.edges[i].prefix[0] <= n.edges[i-1].prefix[0] {
+			return nil, ErrCorrupt
+		}
+	}
+
+	n.layout()
+
+	// Nodes other than the root are never empty
+	if !root && n.leaf == nil && len(n.edges) < 2 {
+		return nil, ErrCorrupt
+	}
+
+	n.recount()
+	n.update(d.agg, d.hash)
+
+	return n, nil
+
+}
+
+type checkWriter struct {
+	w io.Writer
+	h hash.Hash32
+	n int64
+}
+
+func (c *checkWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.h.Write(p[:n])
+	c.n += int64(n)
+	return n, err
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+type checkReader struct {
+	r byteReader
+	h hash.Hash32
+	n int64
+}
+
+func (c *checkReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.h.Write(p[:n])
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *checkReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.h.Write([]byte{b})
+		c.n++
+	}
+	return b, err
+}
@@ -0,0 +1,160 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type intCodec struct{}
+
+func (intCodec) Encode(val int) ([]byte, error) {
+	return binary.AppendVarint(nil, int64(val)), nil
+}
+
+func (intCodec) Decode(data []byte) (int, error) {
+	v, n := binary.Varint(data)
+	if n <= 0 {
+		return 0, ErrCorrupt
+	}
+	return int(v), nil
+}
+
+func TestSnapshot(t *testing.T) {
+
+	c := NewTree[[]byte]().Copy()
+
+	for _, v := range s {
+		c.Put([]byte(v), []byte(v))
+	}
+
+	c.Put(nil, []byte("ROOT"))
+	c.Put([]byte("/empty"), nil)
+
+	p := c.Tree()
+
+	var buf bytes.Buffer
+
+	Convey("Can write a snapshot", t, func() {
+		n, err := p.Snapshot(BytesCodec{}).WriteTo(&buf)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, buf.Len())
+	})
+
+	Convey("Can read a snapshot", t, func() {
+		r := NewSnapshot[[]byte](BytesCodec{})
+		n, err := r.ReadFrom(bytes.NewReader(buf.Bytes()))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, buf.Len())
+		t := r.Tree()
+		So(t.Size(), ShouldEqual, p.Size())
+		So(t.Get(nil), ShouldResemble, []byte("ROOT"))
+		So(t.Get([]byte("/empty")), ShouldBeEmpty)
+		var keys []string
+		t.Walk(nil, func(k []byte, v []byte) bool {
+			keys = append(keys, string(k))
+			return false
+		})
+		So(keys[0], ShouldEqual, "")
+		So(keys[1:3], ShouldResemble, []string{"/empty", s[0]})
+		So(keys[3:], ShouldResemble, s[1:])
+	})
+
+	Convey("Can modify a tree read from a snapshot", t, func() {
+		r := NewSnapshot[[]byte](BytesCodec{})
+		_, err := r.ReadFrom(bytes.NewReader(buf.Bytes()))
+		So(err, ShouldBeNil)
+		c := r.Tree().Copy()
+		for _, v := range s {
+			So(c.Del([]byte(v)), ShouldResemble, []byte(v))
+		}
+		c.Put([]byte("/test/one/sub"), []byte("SUB"))
+		So(c.Size(), ShouldEqual, 3)
+		So(c.Get([]byte("/test/one/sub")), ShouldResemble, []byte("SUB"))
+	})
+
+	Convey("Can write and read an empty tree", t, func() {
+		var buf bytes.Buffer
+		_, err := NewTree[int]().Snapshot(intCodec{}).WriteTo(&buf)
+		So(err, ShouldBeNil)
+		r := NewSnapshot[int](intCodec{})
+		_, err = r.ReadFrom(&buf)
+		So(err, ShouldBeNil)
+		So(r.Tree().Size(), ShouldEqual, 0)
+	})
+
+	Convey("Can write and read typed values", t, func() {
+		c := NewTree[int]().Copy()
+		for i, v := range s {
+			c.Put([]byte(v), -i)
+		}
+		var buf bytes.Buffer
+		_, err := c.Tree().Snapshot(intCodec{}).WriteTo(&buf)
+		So(err, ShouldBeNil)
+		r := NewSnapshot[int](intCodec{})
+		_, err = r.ReadFrom(&buf)
+		So(err, ShouldBeNil)
+		for i, v := range s {
+			So(r.Tree().Get([]byte(v)), ShouldEqual, -i)
+		}
+	})
+
+	Convey("Cannot read a corrupt snapshot", t, func() {
+		for _, i := range []int{6, buf.Len() / 2, buf.Len() - 1} {
+			b := append([]byte(nil), buf.Bytes()...)
+			b[i] ^= 0x10
+			r := NewSnapshot[[]byte](BytesCodec{})
+			_, err := r.ReadFrom(bytes.NewReader(b))
+			So(err, ShouldNotBeNil)
+			So(r.Tree().Size(), ShouldEqual, 0)
+		}
+	})
+
+	Convey("Cannot read a truncated snapshot", t, func() {
+		for _, i := range []int{0, 3, 5, buf.Len() / 2, buf.Len() - 1} {
+			r := NewSnapshot[[]byte](BytesCodec{})
+			_, err := r.ReadFrom(bytes.NewReader(buf.Bytes()[:i]))
+			So(err, ShouldEqual, ErrCorrupt)
+		}
+	})
+
+	Convey("Cannot read a snapshot which nests too deeply", t, func() {
+		b := append([]byte(nil), snapshotMagic[:]...)
+		b = append(b, snapshotVersion, 1)
+		// An empty root with a single edge
+		b = append(b, 0, 0, 1)
+		for i := 0; i < 2*snapshotMaxDepth; i++ {
+			// A node with a single edge
+			b = append(b, 1, 'a', 0, 1)
+		}
+		r := NewSnapshot[[]byte](BytesCodec{})
+		n, err := r.ReadFrom(bytes.NewReader(b))
+		So(err, ShouldEqual, ErrCorrupt)
+		So(n, ShouldBeLessThan, len(b)/2+8)
+	})
+
+	Convey("Cannot read an unknown snapshot version", t, func() {
+		b := append([]byte(nil), buf.Bytes()...)
+		b[4] = 99
+		r := NewSnapshot[[]byte](BytesCodec{})
+		_, err := r.ReadFrom(bytes.NewReader(b))
+		So(err, ShouldEqual, ErrVersion)
+	})
+
+}
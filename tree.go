@@ -14,29 +14,168 @@
 
 package ptree
 
-// Tree represents an immutable radix tree.
-type Tree struct {
+// TreeOf represents an immutable radix tree holding values of type
+// V. A tree can never be modified, and is safe to be read from
+// multiple goroutines at once. Use Copy to start a transaction for
+// making changes.
+type TreeOf[V any] struct {
 	size int
-	root *Node
+	root *NodeOf[V]
+	agg  aggregator[V]
+	hash Hasher[V]
+	subs []Subscriber[V]
 }
 
-// New returns an empty Tree
+// Tree is a radix tree which holds values of any type.
+type Tree = TreeOf[any]
+
+// Option configures a new Tree.
+type Option[V any] func(*TreeOf[V])
+
+// New returns an empty Tree which can hold values of any type.
 func New() *Tree {
-	return &Tree{root: &Node{}}
+	return NewTree[any]()
+}
+
+// NewTree returns an empty Tree which holds values of type V,
+// configured using any specified options. Trees derived from this
+// tree keep the same configuration.
+func NewTree[V any](opts ...Option[V]) *TreeOf[V] {
+	t := &TreeOf[V]{root: &NodeOf[V]{}}
+	for _, o := range opts {
+		o(t)
+	}
+	t.root.update(t.agg, t.hash)
+	return t
 }
 
 // Size is used to return the total number of elements in the tree.
-func (t *Tree) Size() int {
+func (t *TreeOf[V]) Size() int {
 	return t.size
 }
 
+// Root returns the root node within this radix tree.
+func (t *TreeOf[V]) Root() *NodeOf[V] {
+	return t.root
+}
+
+// Cursor returns a new read-only iterator for iterating through the
+// radix tree.
+func (t *TreeOf[V]) Cursor() *IteratorOf[V] {
+	return &IteratorOf[V]{tree: t}
+}
+
+// Get is used to retrieve a specific key, returning the current value.
+func (t *TreeOf[V]) Get(key []byte) V {
+	val, _ := t.root.get(key)
+	return val
+}
+
+// GetOK is used to retrieve a specific key, returning the current value,
+// and whether the key exists within the tree.
+func (t *TreeOf[V]) GetOK(key []byte) (V, bool) {
+	return t.root.get(key)
+}
+
+// LongestPrefix returns the key and value of the longest key in the
+// tree which is a prefix of the specified key, and whether any such
+// key exists within the tree.
+func (t *TreeOf[V]) LongestPrefix(key []byte) ([]byte, V, bool) {
+	return t.root.match(key).unpackOK()
+}
+
+// Min returns the key and value of the minimum item in the tree.
+func (t *TreeOf[V]) Min() ([]byte, V) {
+	return t.root.Min()
+}
+
+// Max returns the key and value of the maximum item in the tree.
+func (t *TreeOf[V]) Max() ([]byte, V) {
+	return t.root.Max()
+}
+
+// Path is used to recurse over the tree only visiting nodes
+// which are above the specified key in the tree.
+func (t *TreeOf[V]) Path(key []byte, f WalkerOf[V]) {
+	t.root.Path(key, f)
+}
+
+// Subs is used to recurse over the tree only visiting nodes
+// which are directly under the specified key in the tree.
+func (t *TreeOf[V]) Subs(key []byte, f WalkerOf[V]) {
+	t.root.Subs(key, f)
+}
+
+// Walk is used to recurse over the tree only visiting nodes
+// which are under the specified key in the tree.
+func (t *TreeOf[V]) Walk(key []byte, f WalkerOf[V]) {
+	t.root.Walk(key, f)
+}
+
+// Watch returns a channel which is closed when any key with the
+// specified prefix is changed by a committed Copy. As changes are
+// detected per node, the channel may also be closed by changes to
+// nearby keys. Only copies which have been configured using Notify
+// will close watch channels.
+func (t *TreeOf[V]) Watch(prefix []byte) <-chan struct{} {
+	return t.root.cover(prefix).Watch()
+}
+
 // Copy starts a new transaction that can be used to mutate the tree.
-func (t *Tree) Copy() *Copy {
-	return &Copy{size: t.size, root: t.root}
+func (t *TreeOf[V]) Copy() *CopyOf[V] {
+	return &CopyOf[V]{size: t.size, root: t.root, agg: t.agg, hash: t.hash, rec: len(t.subs) != 0, subs: t.subs}
+}
+
+// Range is used to iterate over the tree in ascending order, only
+// visiting keys between the start and end keys, as set out by Bounds.
+func (t *TreeOf[V]) Range(start, end []byte, f WalkerOf[V], b ...Bounds) {
+	t.Cursor().scan(start, end, bounds(b), f)
+}
+
+// ReverseRange is used to iterate over the tree in descending order,
+// only visiting keys between the start and end keys, as set out by
+// Bounds.
+func (t *TreeOf[V]) ReverseRange(start, end []byte, f WalkerOf[V], b ...Bounds) {
+	t.Cursor().rscan(start, end, bounds(b), f)
 }
 
-// Walker represents a callback function which is to be used when
+func (t *TreeOf[V]) top() *NodeOf[V] {
+	return t.root
+}
+
+func (t *TreeOf[V]) version() uint64 {
+	return 0
+}
+
+// WalkerOf represents a callback function which is to be used when
 // iterating through the tree using Path, Subs, or Walk. It will be
 // populated with the key and value of the current item, and returns
 // a bool signifying if the iteration should be terminated.
-type Walker func(key []byte, val interface{}) (exit bool)
+type WalkerOf[V any] func(key []byte, val V) (exit bool)
+
+// Walker is a callback function for a tree which holds values of
+// any type.
+type Walker = WalkerOf[any]
+
+// Bounds specifies whether the start and end keys of a range are
+// themselves included within the range. A nil start or end key
+// leaves that side of the range unbounded. If no bounds are given,
+// then the start key is included and the end key is excluded.
+type Bounds uint8
+
+const (
+	// IncludeStart includes the start key of the range.
+	IncludeStart Bounds = 1 << iota
+	// IncludeEnd includes the end key of the range.
+	IncludeEnd
+)
+
+func bounds(b []Bounds) (r Bounds) {
+	if len(b) == 0 {
+		return IncludeStart
+	}
+	for _, v := range b {
+		r |= v
+	}
+	return
+}
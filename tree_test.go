@@ -15,7 +15,10 @@
 package ptree
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"sync"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -639,7 +642,8 @@ func TestIterate(t *testing.T) {
 		for _, q := range i.path {
 			t = append(t, q.pos)
 		}
-		So(fmt.Sprint(t), ShouldEqual, fmt.Sprint(p[11]))
+		// The path reflects the merged nodes
+		So(fmt.Sprint(t), ShouldEqual, "[0 1 0 0 0 2 0]")
 		So(k, ShouldResemble, []byte(s[11]))
 		So(v, ShouldResemble, []byte(s[11]))
 	})
@@ -659,13 +663,291 @@ func TestIterate(t *testing.T) {
 		for _, q := range i.path {
 			t = append(t, q.pos)
 		}
-		So(fmt.Sprint(t), ShouldEqual, fmt.Sprint(p[15]))
+		// The path reflects the merged nodes
+		So(fmt.Sprint(t), ShouldEqual, "[0 1 0 1 0]")
 		So(k, ShouldResemble, []byte(s[15]))
 		So(v, ShouldResemble, []byte(s[15]))
 	})
 
 }
 
+func TestSeek(t *testing.T) {
+
+	c := New().Copy()
+
+	for _, v := range s {
+		c.Put([]byte(v), []byte(v))
+	}
+
+	i := c.Cursor()
+
+	tests := []struct {
+		key            []byte
+		le, lt, ge, gt int
+	}{
+		{nil, -1, -1, 0, 0},
+		{[]byte{0}, -1, -1, 0, 0},
+		{[]byte("/aaa"), -1, -1, 0, 0},
+		{[]byte(s[0]), 0, -1, 0, 1},
+		{[]byte("/zoo/some/path/-"), 34, 34, -1, -1},
+		{[]byte("/zzz"), 34, 34, -1, -1},
+		{[]byte{255}, 34, 34, -1, -1},
+		{[]byte(s[34]), 34, 33, 34, -1},
+		{[]byte(s[10][:len(s[10])-3]), 9, 9, 10, 10},
+		{[]byte(s[10]), 10, 9, 10, 11},
+		{[]byte("/test/one/sub-zen/0th"), 9, 9, 10, 10},
+		{[]byte("/test/one/sub-zen/1zz"), 10, 10, 11, 11},
+		{[]byte("/test/one/sub-zen/2zz"), 11, 11, 12, 12},
+		{[]byte("/test/one/sub-zen/3rd"), 11, 11, 12, 12},
+		{[]byte("/test/zzz"), 31, 31, 32, 32},
+		{[]byte("/zoo/some/xxxx"), 34, 34, -1, -1},
+		{[]byte(s[32]), 32, 31, 32, 33},
+	}
+
+	check := func(k []byte, v interface{}, idx int) {
+		if idx < 0 {
+			So(k, ShouldBeNil)
+			So(v, ShouldBeNil)
+		} else {
+			So(k, ShouldResemble, []byte(s[idx]))
+			So(v, ShouldResemble, []byte(s[idx]))
+		}
+	}
+
+	Convey("Can seek to keys less than or equal to a key", t, func() {
+		for _, test := range tests {
+			k, v := i.SeekLE(test.key)
+			check(k, v, test.le)
+		}
+	})
+
+	Convey("Can seek to keys less than a key", t, func() {
+		for _, test := range tests {
+			k, v := i.SeekLT(test.key)
+			check(k, v, test.lt)
+		}
+	})
+
+	Convey("Can seek to keys greater than or equal to a key", t, func() {
+		for _, test := range tests {
+			k, v := i.Seek(test.key)
+			check(k, v, test.ge)
+		}
+	})
+
+	Convey("Can seek to keys greater than a key", t, func() {
+		for _, test := range tests {
+			k, v := i.SeekGT(test.key)
+			check(k, v, test.gt)
+		}
+	})
+
+	Convey("Can iterate after seeking", t, func() {
+		for _, test := range tests {
+			if test.le >= 0 {
+				i.SeekLE(test.key)
+				for j := test.le - 1; j >= 0; j-- {
+					k, v := i.Prev()
+					check(k, v, j)
+				}
+				k, v := i.Prev()
+				check(k, v, -1)
+			}
+			if test.lt >= 0 && test.lt+1 < len(s) {
+				i.SeekLT(test.key)
+				k, v := i.Next()
+				check(k, v, test.lt+1)
+			}
+			if test.gt >= 1 {
+				i.SeekGT(test.key)
+				k, v := i.Prev()
+				check(k, v, test.gt-1)
+			}
+		}
+	})
+
+	Convey("Can seek to keys between sibling edges", t, func() {
+		for _, keys := range [][]string{
+			{"a", "c"},
+			{"a", "c", "e", "f"},
+			{"a\x00ba", "\xff\x00\xff"},
+			{"b", "d"},
+			{"ab", "ad", "b"},
+		} {
+			c := New().Copy()
+			for _, k := range keys {
+				c.Put([]byte(k), k)
+			}
+			i := c.Cursor()
+			for _, probe := range []string{"", "\x00", "a", "b", "c", "ac", "ae", "zzz", "\xff", "\xff\xff"} {
+				le, lt, ge, gt := "-", "-", "-", "-"
+				for _, k := range keys {
+					if k <= probe {
+						le = k
+					}
+					if k < probe {
+						lt = k
+					}
+					if k >= probe && ge == "-" {
+						ge = k
+					}
+					if k > probe && gt == "-" {
+						gt = k
+					}
+				}
+				name := func(k []byte, _ any) string {
+					if k == nil {
+						return "-"
+					}
+					return string(k)
+				}
+				So(name(i.SeekLE([]byte(probe))), ShouldEqual, le)
+				So(name(i.SeekLT([]byte(probe))), ShouldEqual, lt)
+				So(name(i.Seek([]byte(probe))), ShouldEqual, ge)
+				So(name(i.SeekGT([]byte(probe))), ShouldEqual, gt)
+			}
+		}
+	})
+
+}
+
+func TestStable(t *testing.T) {
+
+	fill := func() *Copy {
+		c := New().Copy()
+		for _, v := range s {
+			c.Put([]byte(v), []byte(v))
+		}
+		return c
+	}
+
+	Convey("Can delete the current item while iterating", t, func() {
+		c := fill()
+		i := c.Cursor()
+		j := 0
+		for k, _ := i.First(); k != nil; k, _ = i.Next() {
+			So(k, ShouldResemble, []byte(s[j]))
+			i.Del()
+			j++
+		}
+		So(j, ShouldEqual, len(s))
+		So(c.Size(), ShouldEqual, 0)
+	})
+
+	Convey("Can delete the current item while iterating backwards", t, func() {
+		c := fill()
+		i := c.Cursor()
+		j := len(s) - 1
+		for k, _ := i.Last(); k != nil; k, _ = i.Prev() {
+			So(k, ShouldResemble, []byte(s[j]))
+			c.Del(k)
+			j--
+		}
+		So(j, ShouldEqual, -1)
+		So(c.Size(), ShouldEqual, 0)
+	})
+
+	Convey("Can delete other items while iterating", t, func() {
+		c := fill()
+		i := c.Cursor()
+		var keys []string
+		for k, _ := i.First(); k != nil; k, _ = i.Next() {
+			keys = append(keys, string(k))
+			c.Del([]byte(string(k) + "/2nd"))
+		}
+		So(len(keys), ShouldEqual, len(s)-9)
+	})
+
+	Convey("Can insert items before the current item while iterating", t, func() {
+		c := fill()
+		i := c.Cursor()
+		j := 0
+		for k, _ := i.First(); k != nil; k, _ = i.Next() {
+			So(k, ShouldResemble, []byte(s[j]))
+			c.Put(append([]byte(s[j][:len(s[j])-1]), 0), nil)
+			j++
+		}
+		So(j, ShouldEqual, len(s))
+		So(c.Size(), ShouldEqual, 2*len(s))
+	})
+
+	Convey("Can insert items after the current item while iterating", t, func() {
+		c := fill()
+		i := c.Cursor()
+		var keys []string
+		for k, _ := i.First(); k != nil; k, _ = i.Next() {
+			keys = append(keys, string(k))
+			if bytes.HasSuffix(k, []byte("/1st")) {
+				c.Put([]byte(string(k)+"/new"), nil)
+			}
+		}
+		So(len(keys), ShouldEqual, len(s)+9)
+		So(keys[5], ShouldEqual, "/test/one/sub-one/1st/new")
+	})
+
+	Convey("Can insert items after the current item while iterating backwards", t, func() {
+		c := fill()
+		i := c.Cursor()
+		j := len(s) - 1
+		for k, _ := i.Last(); k != nil; k, _ = i.Prev() {
+			So(k, ShouldResemble, []byte(s[j]))
+			c.Put([]byte(s[j]+"/new"), nil)
+			j--
+		}
+		So(j, ShouldEqual, -1)
+		So(c.Size(), ShouldEqual, 2*len(s))
+	})
+
+	sibs := func() *Copy {
+		c := New().Copy()
+		for _, v := range []string{"a", "c", "e", "f"} {
+			c.Put([]byte(v), v)
+		}
+		return c
+	}
+
+	Convey("Can delete the current item between sibling keys", t, func() {
+		c := sibs()
+		i := c.Cursor()
+		var keys []string
+		for k, _ := i.First(); k != nil; k, _ = i.Next() {
+			keys = append(keys, string(k))
+			if string(k) == "c" {
+				i.Del()
+			}
+		}
+		So(keys, ShouldResemble, []string{"a", "c", "e", "f"})
+		So(c.Size(), ShouldEqual, 3)
+	})
+
+	Convey("Can insert items before the current item between sibling keys", t, func() {
+		c := sibs()
+		i := c.Cursor()
+		var keys []string
+		for k, _ := i.First(); k != nil; k, _ = i.Next() {
+			keys = append(keys, string(k))
+			if string(k) == "c" {
+				c.Put([]byte("b"), "b")
+			}
+		}
+		So(keys, ShouldResemble, []string{"a", "c", "e", "f"})
+	})
+
+	Convey("Can insert items after the current item between sibling keys", t, func() {
+		c := sibs()
+		i := c.Cursor()
+		var keys []string
+		for k, _ := i.First(); k != nil; k, _ = i.Next() {
+			keys = append(keys, string(k))
+			if string(k) == "c" {
+				c.Put([]byte("d"), "d")
+			}
+		}
+		So(keys, ShouldResemble, []string{"a", "c", "d", "e", "f"})
+	})
+
+}
+
 func TestUpdate(t *testing.T) {
 
 	c := New().Copy()
@@ -725,3 +1007,1206 @@ func TestDelete(t *testing.T) {
 	})
 
 }
+
+// valid checks that every node other than the root has either a
+// leaf or at least two edges, that edges are sorted, and that the
+// subtree counts are correct.
+func valid[V any](n *NodeOf[V], root bool) bool {
+	if !root && n.leaf == nil && len(n.edges) < 2 {
+		return false
+	}
+	num := 0
+	if n.leaf != nil {
+		num++
+	}
+	if len(n.labels) != len(n.edges) || len(n.edges) > denseEdges && n.index == nil || len(n.edges) <= sparseEdges && n.index != nil {
+		return false
+	}
+	if n.index != nil {
+		for l, i := range n.index {
+			if i != 0 && (int(i) > len(n.edges) || n.edges[i-1].prefix[0] != byte(l)) {
+				return false
+			}
+		}
+	}
+	for i, e := range n.edges {
+		if len(e.prefix) == 0 || i > 0 && e.prefix[0] <= n.edges[i-1].prefix[0] {
+			return false
+		}
+		if n.index != nil && n.index[e.prefix[0]] != uint16(i+1) {
+			return false
+		}
+		if n.labels[i] != e.prefix[0] {
+			return false
+		}
+		if !valid(e, false) {
+			return false
+		}
+		num += e.count
+	}
+	return n.count == num
+}
+
+func TestLayout(t *testing.T) {
+
+	keys := make([][]byte, 0, 256*3)
+	for i := 255; i >= 0; i-- {
+		keys = append(keys, []byte{'/', byte(i)}, []byte{'/', byte(i), 'a'}, []byte{'/', byte(i), 'b'})
+	}
+
+	Convey("Can grow and shrink wide nodes", t, func() {
+		c := New().Copy()
+		for i, k := range keys {
+			c.Put(k, i)
+			if i%50 == 0 {
+				So(valid(c.Root(), true), ShouldBeTrue)
+			}
+		}
+		p := c.Tree()
+		So(valid(p.Root(), true), ShouldBeTrue)
+		So(p.Root().edges[0].index, ShouldNotBeNil)
+		for i, k := range keys {
+			So(p.Get(k), ShouldEqual, i)
+		}
+		So(p.Get([]byte{'/', 0, 'c'}), ShouldBeNil)
+		key, _ := p.Cursor().Seek([]byte{'/', 100, 'c'})
+		So(key, ShouldResemble, []byte{'/', 101})
+		c = p.Copy()
+		for i, k := range keys {
+			if k[1]%8 != 0 {
+				c.Del(k)
+			}
+			if i%50 == 0 {
+				So(valid(c.Root(), true), ShouldBeTrue)
+			}
+		}
+		So(valid(c.Root(), true), ShouldBeTrue)
+		So(c.Root().edges[0].index, ShouldBeNil)
+		So(c.Size(), ShouldEqual, 32*3)
+		So(valid(p.Root(), true), ShouldBeTrue)
+		So(p.Size(), ShouldEqual, len(keys))
+	})
+
+	Convey("Wide nodes are restored from snapshots", t, func() {
+		var buf bytes.Buffer
+		c := NewTree[[]byte]().Copy()
+		for _, k := range keys {
+			c.Put(k, k)
+		}
+		_, err := c.Tree().Snapshot(BytesCodec{}).WriteTo(&buf)
+		So(err, ShouldBeNil)
+		r := NewSnapshot[[]byte](BytesCodec{})
+		_, err = r.ReadFrom(&buf)
+		So(err, ShouldBeNil)
+		So(valid(r.Tree().Root(), true), ShouldBeTrue)
+		So(r.Tree().Get([]byte{'/', 200, 'b'}), ShouldResemble, []byte{'/', 200, 'b'})
+	})
+
+}
+
+func TestDeletePrefix(t *testing.T) {
+
+	c := New().Copy()
+
+	for _, v := range s {
+		c.Put([]byte(v), []byte(v))
+	}
+
+	p := c.Tree()
+
+	probes := [][]byte{{}, {0}, []byte("/"), []byte("/t"), []byte("/test/one/sub-"), []byte("/zzz")}
+	for _, v := range s {
+		probes = append(probes, []byte(v), []byte(v[:len(v)-1]), []byte(v+"/"))
+	}
+
+	Convey("Can delete keys by prefix", t, func() {
+		var failed []string
+		for _, pre := range probes {
+			var keep []string
+			for _, v := range s {
+				if !bytes.HasPrefix([]byte(v), pre) {
+					keep = append(keep, v)
+				}
+			}
+			c := p.Copy()
+			num := c.DeletePrefix(pre)
+			var keys []string
+			c.Root().Walk(nil, func(k []byte, _ any) bool {
+				keys = append(keys, string(k))
+				return false
+			})
+			if num != len(s)-len(keep) || c.Size() != len(keep) || fmt.Sprint(keys) != fmt.Sprint(keep) || !valid(c.Root(), true) {
+				failed = append(failed, string(pre))
+			}
+			for _, v := range keep {
+				if _, ok := c.GetOK([]byte(v)); !ok {
+					failed = append(failed, string(pre))
+				}
+			}
+		}
+		So(failed, ShouldBeEmpty)
+		So(p.Size(), ShouldEqual, len(s))
+	})
+
+	Convey("Can put keys after deleting a prefix", t, func() {
+		c := p.Copy()
+		So(c.DeletePrefix([]byte("/test/one/")), ShouldEqual, 9)
+		So(c.DeletePrefix([]byte("/test/one/")), ShouldEqual, 0)
+		c.Put([]byte("/test/one/sub-new"), nil)
+		So(c.Size(), ShouldEqual, len(s)-8)
+		So(c.DeletePrefix(nil), ShouldEqual, len(s)-8)
+		So(c.Size(), ShouldEqual, 0)
+		c.Put([]byte("/test"), nil)
+		So(c.Tree().Size(), ShouldEqual, 1)
+	})
+
+	Convey("Records the deleted prefix and replaced nodes", t, func() {
+		w := p.Watch([]byte("/test/two/sub-one/1st"))
+		o := p.Watch([]byte("/test/one"))
+		c := p.Copy()
+		c.Notify(true)
+		c.dirty = &writes{keys: make(map[string]struct{})}
+		So(c.DeletePrefix([]byte("/test/two/sub-o")), ShouldEqual, 3)
+		So(c.dirty.keys, ShouldBeEmpty)
+		So(c.dirty.spans, ShouldResemble, []span{{start: []byte("/test/two/sub-o"), end: []byte("/test/two/sub-p")}})
+		So(closed(w), ShouldBeFalse)
+		c.Tree()
+		So(closed(w), ShouldBeTrue)
+		So(closed(o), ShouldBeFalse)
+	})
+
+}
+
+func TestDeleteRange(t *testing.T) {
+
+	c := New().Copy()
+
+	for _, v := range s {
+		c.Put([]byte(v), []byte(v))
+	}
+
+	p := c.Tree()
+
+	probes := [][]byte{nil, {}, {0}, {255}, []byte("/"), []byte("/test/one/sub-"), []byte("/zzz")}
+	for _, v := range s {
+		probes = append(probes, []byte(v), []byte(v[:len(v)-1]), []byte(v+"\x00"), []byte(v+"/"))
+	}
+
+	Convey("Can delete keys between two keys", t, func() {
+		var failed []string
+		for _, start := range probes {
+			for _, end := range probes {
+				var keep []string
+				for _, v := range s {
+					if (start != nil && v < string(start)) || (end != nil && v >= string(end)) {
+						keep = append(keep, v)
+					}
+				}
+				c := p.Copy()
+				num := c.DeleteRange(start, end)
+				var keys []string
+				c.Root().Walk(nil, func(k []byte, _ any) bool {
+					keys = append(keys, string(k))
+					return false
+				})
+				if num != len(s)-len(keep) || c.Size() != len(keep) || fmt.Sprint(keys) != fmt.Sprint(keep) || !valid(c.Root(), true) {
+					failed = append(failed, fmt.Sprintf("%q-%q", start, end))
+				}
+			}
+		}
+		So(failed, ShouldBeEmpty)
+		So(p.Size(), ShouldEqual, len(s))
+	})
+
+	Convey("Can put keys after deleting a range", t, func() {
+		c := p.Copy()
+		So(c.DeleteRange([]byte("/test/one"), []byte("/test/two/sub-two")), ShouldEqual, 14)
+		So(c.DeleteRange([]byte("/test/one"), []byte("/test/two/sub-two")), ShouldEqual, 0)
+		c.Put([]byte("/test/one/sub-new"), nil)
+		So(c.Get([]byte("/test/two/sub-two")), ShouldResemble, []byte("/test/two/sub-two"))
+		So(c.Size(), ShouldEqual, len(s)-13)
+		So(c.DeleteRange(nil, nil), ShouldEqual, len(s)-13)
+		So(c.Tree().Size(), ShouldEqual, 0)
+	})
+
+}
+
+func TestCount(t *testing.T) {
+
+	c := New().Copy()
+
+	for _, v := range s {
+		c.Put([]byte(v), []byte(v))
+	}
+
+	p := c.Tree()
+
+	probes := [][]byte{nil, {}, {0}, {255}, []byte("/"), []byte("/test/one/sub-"), []byte("/zzz")}
+	for _, v := range s {
+		probes = append(probes, []byte(v), []byte(v[:len(v)-1]), []byte(v+"\x00"), []byte(v+"/"))
+	}
+
+	Convey("Counts are maintained through changes", t, func() {
+		So(valid(p.Root(), true), ShouldBeTrue)
+		So(p.Root().Count(), ShouldEqual, len(s))
+		c := p.Copy()
+		c.Del([]byte("/zoo"))
+		c.Del([]byte("/test/one/sub-one"))
+		c.Put([]byte("/test/one/sub-"), nil)
+		c.Put([]byte("/test/o"), nil)
+		So(valid(c.Root(), true), ShouldBeTrue)
+		So(c.Root().Count(), ShouldEqual, c.Size())
+	})
+
+	Convey("Can count keys by prefix", t, func() {
+		var failed []string
+		for _, pre := range probes {
+			num := 0
+			for _, v := range s {
+				if bytes.HasPrefix([]byte(v), pre) {
+					num++
+				}
+			}
+			if p.CountPrefix(pre) != num {
+				failed = append(failed, string(pre))
+			}
+		}
+		So(failed, ShouldBeEmpty)
+	})
+
+	Convey("Can rank and select keys", t, func() {
+		var failed []string
+		for _, k := range probes {
+			num := 0
+			for _, v := range s {
+				if v < string(k) {
+					num++
+				}
+			}
+			if p.Rank(k) != num {
+				failed = append(failed, string(k))
+			}
+		}
+		So(failed, ShouldBeEmpty)
+		for i, v := range s {
+			key, val := p.Select(i)
+			So(string(key), ShouldEqual, v)
+			So(val, ShouldResemble, []byte(v))
+			So(p.Rank(key), ShouldEqual, i)
+		}
+		key, val := p.Select(len(s))
+		So(key, ShouldBeNil)
+		So(val, ShouldBeNil)
+		key, _ = p.Select(-1)
+		So(key, ShouldBeNil)
+	})
+
+	Convey("Can count keys between two keys", t, func() {
+		var failed []string
+		for _, start := range probes {
+			for _, end := range probes {
+				for b := Bounds(0); b <= IncludeStart|IncludeEnd; b++ {
+					num := 0
+					p.Range(start, end, func(k []byte, _ any) bool {
+						num++
+						return false
+					}, b)
+					if p.CountRange(start, end, b) != num {
+						failed = append(failed, fmt.Sprintf("%q-%q %d", start, end, b))
+					}
+				}
+			}
+		}
+		So(failed, ShouldBeEmpty)
+	})
+
+	Convey("Counts are restored from snapshots", t, func() {
+		var buf bytes.Buffer
+		c := NewTree[[]byte]().Copy()
+		for _, v := range s {
+			c.Put([]byte(v), []byte(v))
+		}
+		_, err := c.Tree().Snapshot(BytesCodec{}).WriteTo(&buf)
+		So(err, ShouldBeNil)
+		r := NewSnapshot[[]byte](BytesCodec{})
+		_, err = r.ReadFrom(&buf)
+		So(err, ShouldBeNil)
+		So(valid(r.Tree().Root(), true), ShouldBeTrue)
+		So(r.Tree().CountPrefix([]byte("/test/")), ShouldEqual, 30)
+	})
+
+}
+
+type byteTotal struct{}
+
+func (byteTotal) Zero() int                       { return 0 }
+func (byteTotal) Leaf(key []byte, val []byte) int { return len(val) }
+func (byteTotal) Combine(a, b int) int            { return a + b }
+
+func TestAggregate(t *testing.T) {
+
+	c := NewTree(WithAggregator[[]byte, int](byteTotal{})).Copy()
+
+	for _, v := range s {
+		c.Put([]byte(v), []byte(v))
+	}
+
+	p := c.Tree()
+
+	total := func(f func(string) bool) (num int) {
+		for _, v := range s {
+			if f(v) {
+				num += len(v)
+			}
+		}
+		return
+	}
+
+	probes := [][]byte{nil, {}, {0}, {255}, []byte("/"), []byte("/test/one/sub-"), []byte("/zzz")}
+	for _, v := range s {
+		probes = append(probes, []byte(v), []byte(v[:len(v)-1]), []byte(v+"\x00"), []byte(v+"/"))
+	}
+
+	Convey("Trees without an aggregator return nil", t, func() {
+		So(New().Aggregate(nil), ShouldBeNil)
+		So(New().AggregateRange(nil, nil), ShouldBeNil)
+		So(New().Root().Sum(), ShouldBeNil)
+	})
+
+	Convey("Summaries are maintained through changes", t, func() {
+		So(p.Root().Sum(), ShouldEqual, total(func(string) bool { return true }))
+		c := p.Copy()
+		c.Del([]byte("/zoo"))
+		c.Del([]byte("/test/one/sub-one"))
+		c.Put([]byte("/test/one/sub-"), []byte("12345"))
+		c.Put([]byte("/test/o"), []byte("1"))
+		c.DeletePrefix([]byte("/test/two"))
+		c.DeleteRange([]byte("/foo"), []byte("/test"))
+		num := 0
+		c.Root().Walk(nil, func(_ []byte, v []byte) bool {
+			num += len(v)
+			return false
+		})
+		So(c.Aggregate(nil), ShouldEqual, num)
+		So(p.Aggregate(nil), ShouldEqual, total(func(string) bool { return true }))
+		c.DeletePrefix(nil)
+		So(c.Aggregate(nil), ShouldEqual, 0)
+	})
+
+	Convey("Can aggregate keys by prefix", t, func() {
+		var failed []string
+		for _, pre := range probes {
+			num := total(func(v string) bool { return bytes.HasPrefix([]byte(v), pre) })
+			if p.Aggregate(pre) != num {
+				failed = append(failed, string(pre))
+			}
+		}
+		So(failed, ShouldBeEmpty)
+	})
+
+	Convey("Can aggregate keys between two keys", t, func() {
+		var failed []string
+		for _, start := range probes {
+			for _, end := range probes {
+				for b := Bounds(0); b <= IncludeStart|IncludeEnd; b++ {
+					num := 0
+					p.Range(start, end, func(_ []byte, v []byte) bool {
+						num += len(v)
+						return false
+					}, b)
+					if p.AggregateRange(start, end, b) != num {
+						failed = append(failed, fmt.Sprintf("%q-%q %d", start, end, b))
+					}
+				}
+			}
+		}
+		So(failed, ShouldBeEmpty)
+	})
+
+	Convey("Summaries are restored from snapshots", t, func() {
+		var buf bytes.Buffer
+		_, err := p.Snapshot(BytesCodec{}).WriteTo(&buf)
+		So(err, ShouldBeNil)
+		r := NewSnapshot[[]byte](BytesCodec{}, WithAggregator[[]byte, int](byteTotal{}))
+		_, err = r.ReadFrom(&buf)
+		So(err, ShouldBeNil)
+		So(r.Tree().Aggregate([]byte("/test/")), ShouldEqual, p.Aggregate([]byte("/test/")))
+	})
+
+}
+
+func TestLongestPrefix(t *testing.T) {
+
+	c := New().Copy()
+
+	for _, v := range s {
+		c.Put([]byte(v), []byte(v))
+	}
+
+	p := c.Tree()
+
+	Convey("Can find the longest matching prefix", t, func() {
+		key, val, ok := p.LongestPrefix([]byte("/test/one/sub-one/more"))
+		So(ok, ShouldBeTrue)
+		So(string(key), ShouldEqual, "/test/one/sub-one")
+		So(val, ShouldResemble, []byte("/test/one/sub-one"))
+		key, _, ok = p.LongestPrefix([]byte("/test/one/sub-"))
+		So(ok, ShouldBeTrue)
+		So(string(key), ShouldEqual, "/test/one")
+		key, _, ok = c.LongestPrefix([]byte("/test"))
+		So(ok, ShouldBeTrue)
+		So(string(key), ShouldEqual, "/test")
+	})
+
+	Convey("Matches every prefix found using path", t, func() {
+		var failed []string
+		for _, v := range s {
+			for _, k := range []string{v, v[:len(v)-1], v + "/", v + "\x00"} {
+				var last []byte
+				p.Path([]byte(k), func(key []byte, _ any) bool {
+					last = key
+					return false
+				})
+				key, _, ok := p.LongestPrefix([]byte(k))
+				if ok != (last != nil) || !bytes.Equal(key, last) {
+					failed = append(failed, k)
+				}
+			}
+		}
+		So(failed, ShouldBeEmpty)
+	})
+
+	Convey("Returns false without a matching prefix", t, func() {
+		key, val, ok := p.LongestPrefix([]byte("/"))
+		So(ok, ShouldBeFalse)
+		So(key, ShouldBeNil)
+		So(val, ShouldBeNil)
+		_, _, ok = New().LongestPrefix(nil)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Can match the empty key", t, func() {
+		c := p.Copy()
+		c.Put([]byte{}, "root")
+		key, val, ok := c.LongestPrefix([]byte("/"))
+		So(ok, ShouldBeTrue)
+		So(key, ShouldResemble, []byte{})
+		So(val, ShouldEqual, "root")
+	})
+
+}
+
+func TestRange(t *testing.T) {
+
+	c := New().Copy()
+
+	for _, v := range s {
+		c.Put([]byte(v), []byte(v))
+	}
+
+	probes := [][]byte{nil, {}, {0}, {255}, []byte("/"), []byte("/zzz")}
+	for _, v := range s {
+		probes = append(probes,
+			[]byte(v),
+			[]byte(v[:len(v)-1]),
+			[]byte(v+"\x00"),
+			[]byte(v+"-"),
+		)
+	}
+
+	expect := func(start, end []byte, b Bounds) (keys []string) {
+		for _, v := range s {
+			k := []byte(v)
+			if start != nil {
+				if x := bytes.Compare(k, start); x < 0 || x == 0 && b&IncludeStart == 0 {
+					continue
+				}
+			}
+			if end != nil {
+				if x := bytes.Compare(k, end); x > 0 || x == 0 && b&IncludeEnd == 0 {
+					continue
+				}
+			}
+			keys = append(keys, v)
+		}
+		return
+	}
+
+	Convey("Can iterate over ranges", t, func() {
+		var failed []string
+		for _, start := range probes {
+			for _, end := range probes {
+				for b := Bounds(0); b <= IncludeStart|IncludeEnd; b++ {
+					var fwd, rev []string
+					c.Range(start, end, func(k []byte, v interface{}) bool {
+						fwd = append(fwd, string(k))
+						return false
+					}, b)
+					c.ReverseRange(start, end, func(k []byte, v interface{}) bool {
+						rev = append([]string{string(k)}, rev...)
+						return false
+					}, b)
+					exp := fmt.Sprint(expect(start, end, b))
+					if fmt.Sprint(fwd) != exp || fmt.Sprint(rev) != exp {
+						failed = append(failed, fmt.Sprintf("%q-%q (%d)", start, end, b))
+					}
+				}
+			}
+		}
+		So(failed, ShouldBeEmpty)
+	})
+
+	Convey("Ranges include the start and exclude the end by default", t, func() {
+		var keys []string
+		c.Tree().Range([]byte(s[2]), []byte(s[5]), func(k []byte, v interface{}) bool {
+			keys = append(keys, string(k))
+			return false
+		})
+		So(keys, ShouldResemble, s[2:5])
+		keys = nil
+		c.Tree().ReverseRange([]byte(s[2]), []byte(s[5]), func(k []byte, v interface{}) bool {
+			keys = append(keys, string(k))
+			return false
+		})
+		So(keys, ShouldResemble, []string{s[4], s[3], s[2]})
+	})
+
+	Convey("Ranges can start and end between sibling keys", t, func() {
+		c := New().Copy()
+		for _, k := range []string{"a", "c", "d"} {
+			c.Put([]byte(k), k)
+		}
+		p := c.Tree()
+		collect := func(f func(Walker)) (keys []string) {
+			f(func(k []byte, _ any) bool {
+				keys = append(keys, string(k))
+				return false
+			})
+			return
+		}
+		So(collect(func(f Walker) { p.Range([]byte("b"), nil, f) }), ShouldResemble, []string{"c", "d"})
+		So(collect(func(f Walker) { p.Range(nil, []byte("b"), f) }), ShouldResemble, []string{"a"})
+		So(collect(func(f Walker) { p.Range([]byte("b"), []byte("cc"), f) }), ShouldResemble, []string{"c"})
+		So(collect(func(f Walker) { p.ReverseRange(nil, []byte("b"), f) }), ShouldResemble, []string{"a"})
+		So(collect(func(f Walker) { p.ReverseRange([]byte("b"), []byte("e"), f) }), ShouldResemble, []string{"d", "c"})
+		So(collect(func(f Walker) { c.Range([]byte("b"), nil, f) }), ShouldResemble, []string{"c", "d"})
+		So(collect(func(f Walker) { c.ReverseRange(nil, []byte("b"), f) }), ShouldResemble, []string{"a"})
+		var keys []string
+		for k := range p.Between([]byte("b"), nil) {
+			keys = append(keys, string(k))
+		}
+		So(keys, ShouldResemble, []string{"c", "d"})
+	})
+
+	Convey("Ranges can exit early", t, func() {
+		i := 0
+		c.Range(nil, nil, func(k []byte, v interface{}) bool {
+			i++
+			return i == 3
+		})
+		So(i, ShouldEqual, 3)
+		i = 0
+		c.ReverseRange(nil, nil, func(k []byte, v interface{}) bool {
+			i++
+			return i == 5
+		})
+		So(i, ShouldEqual, 5)
+	})
+
+}
+
+func TestSeq(t *testing.T) {
+
+	c := New().Copy()
+
+	for _, v := range s {
+		c.Put([]byte(v), []byte(v))
+	}
+
+	p := c.Tree()
+
+	collect := func(walk func(Walker)) (keys []string) {
+		walk(func(k []byte, _ any) bool {
+			keys = append(keys, string(k))
+			return false
+		})
+		return
+	}
+
+	keys := func(seq func(func([]byte, any) bool)) (keys []string) {
+		for k := range seq {
+			keys = append(keys, string(k))
+		}
+		return
+	}
+
+	Convey("Can iterate over all keys", t, func() {
+		So(keys(p.All()), ShouldResemble, s)
+		So(keys(c.All()), ShouldResemble, s)
+		for k, v := range p.All() {
+			So(v, ShouldResemble, k)
+		}
+	})
+
+	Convey("Can iterate over all keys backwards", t, func() {
+		r := keys(p.Backward())
+		So(r, ShouldHaveLength, len(s))
+		for i, k := range r {
+			So(k, ShouldEqual, s[len(s)-1-i])
+		}
+		So(keys(c.Backward()), ShouldResemble, r)
+	})
+
+	Convey("Matches the callback iterations", t, func() {
+		for _, v := range []string{"", "/test", "/test/one", "/test/one/sub-", "/zzz"} {
+			k := []byte(v)
+			So(keys(p.Prefix(k)), ShouldResemble, collect(func(f Walker) { p.Walk(k, f) }))
+			So(keys(p.Children(k)), ShouldResemble, collect(func(f Walker) { p.Subs(k, f) }))
+			So(keys(p.Ancestors(k)), ShouldResemble, collect(func(f Walker) { p.Path(k, f) }))
+			So(keys(c.Prefix(k)), ShouldResemble, keys(p.Prefix(k)))
+			So(keys(c.Children(k)), ShouldResemble, keys(p.Children(k)))
+			So(keys(c.Ancestors(k)), ShouldResemble, keys(p.Ancestors(k)))
+		}
+	})
+
+	Convey("Can iterate between two keys", t, func() {
+		start, end := []byte("/test/one"), []byte("/test/two")
+		for b := Bounds(0); b <= IncludeStart|IncludeEnd; b++ {
+			want := collect(func(f Walker) { p.Range(start, end, f, b) })
+			So(keys(p.Between(start, end, b)), ShouldResemble, want)
+			So(keys(c.Between(start, end, b)), ShouldResemble, want)
+		}
+	})
+
+	Convey("Can exit the loop early", t, func() {
+		for _, seq := range []func(func([]byte, any) bool){
+			p.All(),
+			p.Backward(),
+			p.Prefix([]byte("/test")),
+			p.Children([]byte("/test")),
+			p.Ancestors([]byte("/test/one/sub-one")),
+			p.Between(nil, nil),
+		} {
+			num := 0
+			for range seq {
+				num++
+				if num == 2 {
+					break
+				}
+			}
+			So(num, ShouldEqual, 2)
+		}
+	})
+
+	Convey("Copy iterators read the copy when the loop starts", t, func() {
+		c := p.Copy()
+		all, back := c.All(), c.Backward()
+		pre, sub := c.Prefix([]byte("/test/zen")), c.Children([]byte("/test/zen"))
+		c.Put([]byte("/test/zen/new"), nil)
+		So(keys(all), ShouldContain, "/test/zen/new")
+		So(keys(back), ShouldContain, "/test/zen/new")
+		So(keys(pre), ShouldContain, "/test/zen/new")
+		So(keys(sub), ShouldContain, "/test/zen/new")
+		So(c.txn, ShouldNotBeNil)
+	})
+
+	Convey("Copy iterators continue after changes made in the loop", t, func() {
+		c := p.Copy()
+		var got []string
+		for k := range c.All() {
+			got = append(got, string(k))
+			if string(k) == "/test/one" {
+				c.Put([]byte("/test/one/a"), nil)
+				c.Del([]byte("/test/one/sub-one"))
+			}
+		}
+		So(got, ShouldContain, "/test/one/a")
+		So(got, ShouldNotContain, "/test/one/sub-one")
+		So(got, ShouldHaveLength, len(s))
+		for _, seq := range []func(func([]byte, any) bool){
+			c.Children([]byte("/test")),
+			c.Ancestors([]byte("/test/one/sub-zen/1st")),
+		} {
+			want := keys(seq)
+			got = nil
+			for k := range seq {
+				got = append(got, string(k))
+				c.Put(append(k, '!'), nil)
+			}
+			So(got, ShouldResemble, want)
+		}
+	})
+
+}
+
+func TestExists(t *testing.T) {
+
+	c := New().Copy()
+
+	Convey("Can distinguish an insert from an update", t, func() {
+		val, ok := c.PutOK([]byte("/test"), nil)
+		So(val, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+		val, ok = c.PutOK([]byte("/test"), []byte("TEST"))
+		So(val, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		val, ok = c.PutOK([]byte("/test"), nil)
+		So(val, ShouldResemble, []byte("TEST"))
+		So(ok, ShouldBeTrue)
+		So(c.Size(), ShouldEqual, 1)
+	})
+
+	Convey("Can distinguish a delete from a missing key", t, func() {
+		val, ok := c.DelOK([]byte("/none"))
+		So(val, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+		val, ok = c.DelOK([]byte("/test"))
+		So(val, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		val, ok = c.DelOK([]byte("/test"))
+		So(val, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+		So(c.Size(), ShouldEqual, 0)
+	})
+
+	Convey("Can iterate over nil values", t, func() {
+		for _, v := range s {
+			c.Put([]byte(v), nil)
+		}
+		i := c.Cursor()
+		j := 0
+		for k, v, ok := i.FirstOK(); ok; k, v, ok = i.NextOK() {
+			So(k, ShouldResemble, []byte(s[j]))
+			So(v, ShouldBeNil)
+			j++
+		}
+		So(j, ShouldEqual, len(s))
+		for _, _, ok := i.LastOK(); ok; _, _, ok = i.PrevOK() {
+			j--
+		}
+		So(j, ShouldEqual, 0)
+		k, _, ok := i.SeekOK([]byte("/test/one/sub-zen/1zz"))
+		So(k, ShouldResemble, []byte(s[11]))
+		So(ok, ShouldBeTrue)
+		k, _, ok = i.SeekOK([]byte("/zzz"))
+		So(k, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+	})
+
+}
+
+func TestIsolation(t *testing.T) {
+
+	c := New().Copy()
+
+	for _, v := range s {
+		c.Put([]byte(v), []byte(v))
+	}
+
+	p := c.Tree()
+
+	Convey("Can modify a copy after committing", t, func() {
+		c.Put([]byte("/test/one"), []byte("ONE"))
+		c.Del([]byte("/test/two"))
+		c.Del([]byte("/zoo/some/path"))
+		c.Put([]byte("/zoo/some/other"), []byte("OTHER"))
+		So(c.Size(), ShouldEqual, 34)
+		So(c.Get([]byte("/test/one")), ShouldResemble, []byte("ONE"))
+		So(c.Get([]byte("/test/two")), ShouldBeNil)
+	})
+
+	Convey("Committed tree is not modified", t, func() {
+		n := p.Copy()
+		So(n.Size(), ShouldEqual, 35)
+		for _, v := range s {
+			So(n.Get([]byte(v)), ShouldResemble, []byte(v))
+		}
+		So(n.Get([]byte("/zoo/some/other")), ShouldBeNil)
+	})
+
+	Convey("Separate copies do not affect each other", t, func() {
+		a, b := p.Copy(), p.Copy()
+		a.Put([]byte("/test/one"), []byte("A"))
+		b.Put([]byte("/test/one"), []byte("B"))
+		a.Del([]byte("/some"))
+		So(a.Get([]byte("/test/one")), ShouldResemble, []byte("A"))
+		So(b.Get([]byte("/test/one")), ShouldResemble, []byte("B"))
+		So(a.Get([]byte("/some")), ShouldBeNil)
+		So(b.Get([]byte("/some")), ShouldResemble, []byte("/some"))
+		So(a.Size(), ShouldEqual, 34)
+		So(b.Size(), ShouldEqual, 35)
+	})
+
+	Convey("Nodes returned from a copy are not modified", t, func() {
+		c := New().Copy()
+		for _, v := range s {
+			c.Put([]byte(v), []byte(v))
+		}
+		var keys []string
+		c.Root().Walk(nil, func(k []byte, _ interface{}) bool {
+			keys = append(keys, string(k))
+			c.Del(k)
+			return false
+		})
+		So(keys, ShouldResemble, s)
+		So(c.Size(), ShouldEqual, 0)
+		for _, v := range s {
+			c.Put([]byte(v), []byte(v))
+		}
+		keys = nil
+		for k := range c.All() {
+			keys = append(keys, string(k))
+			c.Del(k)
+		}
+		So(keys, ShouldResemble, s)
+		So(c.Size(), ShouldEqual, 0)
+	})
+
+}
+
+func TestView(t *testing.T) {
+
+	c := New().Copy()
+
+	for _, v := range s {
+		c.Put([]byte(v), []byte(v))
+	}
+
+	p := c.Tree()
+
+	Convey("Can get items from a tree", t, func() {
+		So(p.Get([]byte("/test/one")), ShouldResemble, []byte("/test/one"))
+		So(p.Get([]byte("/test/on")), ShouldBeNil)
+		So(p.Root(), ShouldEqual, c.Root())
+	})
+
+	Convey("Can get `min` and `max` from a tree", t, func() {
+		k, v := p.Min()
+		So(k, ShouldResemble, []byte(s[0]))
+		So(v, ShouldResemble, []byte(s[0]))
+		k, v = p.Max()
+		So(k, ShouldResemble, []byte(s[len(s)-1]))
+		So(v, ShouldResemble, []byte(s[len(s)-1]))
+	})
+
+	Convey("Can iterate a tree with `walk`, `subs`, and `path`", t, func() {
+		i := 0
+		p.Walk([]byte("/test/zen/s"), func(k []byte, v interface{}) (e bool) {
+			i++
+			return
+		})
+		So(i, ShouldEqual, 9)
+		i = 0
+		p.Subs([]byte("/test/"), func(k []byte, v interface{}) (e bool) {
+			i++
+			return
+		})
+		So(i, ShouldEqual, 3)
+		i = 0
+		p.Path([]byte("/test/zen/sub-one"), func(k []byte, v interface{}) (e bool) {
+			i++
+			return
+		})
+		So(i, ShouldEqual, 3)
+	})
+
+	Convey("Can iterate a tree with a cursor", t, func() {
+		i := p.Cursor()
+		j := 0
+		for k, _ := i.First(); k != nil; k, _ = i.Next() {
+			So(k, ShouldResemble, []byte(s[j]))
+			j++
+		}
+		So(j, ShouldEqual, len(s))
+		k, _ := i.Seek([]byte("/test/one/sub-zen/1zz"))
+		So(k, ShouldResemble, []byte(s[11]))
+		k, _ = i.Prev()
+		So(k, ShouldResemble, []byte(s[10]))
+	})
+
+	Convey("Can iterate a tree concurrently", t, func() {
+		var wg sync.WaitGroup
+		res := make([]int, 8)
+		for w := range res {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				i := p.Cursor()
+				for k, _ := i.Last(); k != nil; k, _ = i.Prev() {
+					if p.Get(k) != nil {
+						res[w]++
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		for _, n := range res {
+			So(n, ShouldEqual, len(s))
+		}
+	})
+
+}
+
+func TestTyped(t *testing.T) {
+
+	c := NewTree[int]().Copy()
+
+	Convey("Can insert typed items", t, func() {
+		for i, v := range s {
+			So(c.Put([]byte(v), i), ShouldEqual, 0)
+		}
+		So(c.Size(), ShouldEqual, 35)
+		So(c.Put([]byte(s[0]), 100), ShouldEqual, 0)
+		So(c.Put([]byte(s[0]), 0), ShouldEqual, 100)
+	})
+
+	Convey("Can distinguish zero values from missing keys", t, func() {
+		v, ok := c.GetOK([]byte(s[0]))
+		So(v, ShouldEqual, 0)
+		So(ok, ShouldBeTrue)
+		v, ok = c.GetOK([]byte("/test/"))
+		So(v, ShouldEqual, 0)
+		So(ok, ShouldBeFalse)
+		v, ok = c.Tree().GetOK([]byte(s[10]))
+		So(v, ShouldEqual, 10)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Can iterate typed items", t, func() {
+		sum := 0
+		c.Root().Walk(nil, func(k []byte, v int) (e bool) {
+			sum += v
+			return
+		})
+		So(sum, ShouldEqual, 34*35/2)
+		i := c.Cursor()
+		k, v := i.Seek([]byte(s[20]))
+		So(k, ShouldResemble, []byte(s[20]))
+		So(v, ShouldEqual, 20)
+	})
+
+	Convey("Can store nil values in an untyped tree", t, func() {
+		c := New().Copy()
+		c.Put([]byte("/nil"), nil)
+		v, ok := c.GetOK([]byte("/nil"))
+		So(v, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+		So(c.Size(), ShouldEqual, 1)
+	})
+
+}
+
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestWatch(t *testing.T) {
+
+	c := New().Copy()
+
+	for _, v := range s {
+		c.Put([]byte(v), []byte(v))
+	}
+
+	p := c.Tree()
+
+	Convey("Channels are not closed by unrelated changes", t, func() {
+		w := p.Watch([]byte("/test/one"))
+		c := p.Copy()
+		c.Notify(true)
+		c.Put([]byte("/test/two/sub-new"), nil)
+		c.Del([]byte("/zoo/some/path"))
+		p = c.Tree()
+		So(closed(w), ShouldBeFalse)
+		So(closed(p.Watch([]byte("/test/one"))), ShouldBeFalse)
+	})
+
+	Convey("Channels are closed when a key is changed", t, func() {
+		w := p.Watch([]byte("/test/one/sub-two/1st"))
+		r := p.Root().Watch()
+		c := p.Copy()
+		c.Notify(true)
+		c.Put([]byte("/test/one/sub-two/1st"), nil)
+		So(closed(w), ShouldBeFalse)
+		p = c.Tree()
+		So(closed(w), ShouldBeTrue)
+		So(closed(r), ShouldBeTrue)
+		So(closed(p.Watch([]byte("/test/one/sub-two/1st"))), ShouldBeFalse)
+	})
+
+	Convey("Channels are closed when a key is added under a prefix", t, func() {
+		w := p.Watch([]byte("/test/one/sub-n"))
+		c := p.Copy()
+		c.Notify(true)
+		c.Put([]byte("/test/one/sub-new"), nil)
+		p = c.Tree()
+		So(closed(w), ShouldBeTrue)
+	})
+
+	Convey("Channels are closed when a node is merged", t, func() {
+		w := p.Watch([]byte("/zoo/some"))
+		c := p.Copy()
+		c.Notify(true)
+		c.Del([]byte("/zoo"))
+		p = c.Tree()
+		So(closed(w), ShouldBeTrue)
+		w = p.Watch([]byte("/zoo/some"))
+		c = p.Copy()
+		c.Notify(true)
+		c.Del([]byte("/zoo/some"))
+		p = c.Tree()
+		So(closed(w), ShouldBeTrue)
+	})
+
+	Convey("Channels are not closed without notify", t, func() {
+		w := p.Watch([]byte("/test"))
+		c := p.Copy()
+		c.Put([]byte("/test"), nil)
+		p = c.Tree()
+		So(closed(w), ShouldBeFalse)
+	})
+
+	Convey("Channels are closed when a DB is updated", t, func() {
+		db := NewDB(p)
+		w := db.Tree().Watch([]byte("/test/zen"))
+		db.Update(func(c *Copy) error {
+			c.Del([]byte("/test/zen/sub-zen/2nd"))
+			return nil
+		})
+		So(closed(w), ShouldBeTrue)
+	})
+
+}
+
+// benchKeys returns keys which are spread evenly across the tree. The
+// keys end in hex digits, or in raw bytes so that the nodes are wide.
+func benchKeys(num int, wide bool) [][]byte {
+	keys := make([][]byte, num)
+	for i := range keys {
+		if wide {
+			keys[i] = binary.BigEndian.AppendUint64([]byte("/test/"), uint64(i)*0x9e3779b97f4a7c15)
+		} else {
+			keys[i] = []byte(fmt.Sprintf("/test/%016x", uint64(i)*0x9e3779b97f4a7c15))
+		}
+	}
+	return keys
+}
+
+// benchTree returns a tree containing each of the keys.
+func benchTree(keys [][]byte) *Tree {
+	c := New().Copy()
+	for _, k := range keys {
+		c.Put(k, k)
+	}
+	return c.Tree()
+}
+
+func BenchmarkPut(b *testing.B) {
+
+	keys := benchKeys(b.N, false)
+
+	c := New().Copy()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		c.Put(keys[i], keys[i])
+	}
+
+}
+
+func BenchmarkPutCommit(b *testing.B) {
+
+	keys := benchKeys(b.N, false)
+
+	t := New()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		c := t.Copy()
+		c.Put(keys[i], keys[i])
+		t = c.Tree()
+	}
+
+}
+
+func BenchmarkDel(b *testing.B) {
+
+	keys := benchKeys(b.N, false)
+
+	c := benchTree(keys).Copy()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		c.Del(keys[i])
+	}
+
+}
+
+func BenchmarkGet(b *testing.B) {
+
+	keys := benchKeys(1<<16, false)
+	t := benchTree(keys)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		t.Get(keys[i&(len(keys)-1)])
+	}
+
+}
+
+func BenchmarkGetWide(b *testing.B) {
+
+	keys := benchKeys(1<<16, true)
+	t := benchTree(keys)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		t.Get(keys[i&(len(keys)-1)])
+	}
+
+}
+
+func BenchmarkSeekWide(b *testing.B) {
+
+	keys := benchKeys(1<<16, true)
+	t := benchTree(keys)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		t.Cursor().Seek(keys[i&(len(keys)-1)][:10])
+	}
+
+}
+
+func BenchmarkWalkWide(b *testing.B) {
+
+	keys := benchKeys(1<<16, true)
+	t := benchTree(keys)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		t.Walk(keys[i&(len(keys)-1)][:7], func(_ []byte, _ any) bool {
+			return false
+		})
+	}
+
+}
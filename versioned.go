@@ -0,0 +1,173 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Versioned keeps a history of committed trees, each identified by a
+// monotonically increasing version. As trees share any unchanged
+// nodes, keeping past versions only costs the nodes which were
+// replaced by later commits. A Versioned is thread safe.
+type Versioned[V any] struct {
+	lock  sync.RWMutex
+	ver   uint64
+	hist  []*version[V]
+	count int
+	age   time.Duration
+	now   func() time.Time
+}
+
+type version[V any] struct {
+	ver  uint64
+	time time.Time
+	tree *TreeOf[V]
+}
+
+// NewVersioned returns a new Versioned store starting with the
+// specified tree as version zero. If the tree is nil, then the
+// store starts off empty.
+func NewVersioned[V any](t *TreeOf[V]) *Versioned[V] {
+	if t == nil {
+		t = NewTree[V]()
+	}
+	v := &Versioned[V]{now: time.Now}
+	v.hist = []*version[V]{{ver: 0, time: v.now(), tree: t}}
+	return v
+}
+
+// Retain sets the retention policy for past versions. At most count
+// versions are kept, and any versions which were committed longer
+// than age ago are removed. A zero count or age leaves that side of
+// the policy unbounded. The latest version is always kept. The
+// policy is applied immediately, and after every commit.
+func (v *Versioned[V]) Retain(count int, age time.Duration) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.count, v.age = count, age
+	v.prune()
+}
+
+// Version returns the latest committed version.
+func (v *Versioned[V]) Version() uint64 {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.ver
+}
+
+// Tree returns the latest committed tree.
+func (v *Versioned[V]) Tree() *TreeOf[V] {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.hist[len(v.hist)-1].tree
+}
+
+// Copy starts a new transaction from the latest committed tree,
+// which can be committed as a new version using Commit.
+func (v *Versioned[V]) Copy() *CopyOf[V] {
+	return v.Tree().Copy()
+}
+
+// Commit commits the changes within the copy, and stores the new
+// tree as the next version, returning the version number. The copy
+// is committed regardless of which tree it was started from.
+func (v *Versioned[V]) Commit(c *CopyOf[V]) uint64 {
+	t := c.Tree()
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.ver++
+	v.hist = append(v.hist, &version[V]{ver: v.ver, time: v.now(), tree: t})
+	v.prune()
+	return v.ver
+}
+
+// At returns the tree which was committed as the specified version,
+// or nil if the version does not exist or is no longer retained.
+func (v *Versioned[V]) At(ver uint64) *TreeOf[V] {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	if i, ok := v.find(ver); ok {
+		return v.hist[i].tree
+	}
+	return nil
+}
+
+// Versions returns the versions which are currently retained, in
+// ascending order.
+func (v *Versioned[V]) Versions() []uint64 {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	vers := make([]uint64, len(v.hist))
+	for i, h := range v.hist {
+		vers[i] = h.ver
+	}
+	return vers
+}
+
+// Release removes the specified version from the history, so that
+// any nodes which are only used by that tree can be reclaimed. The
+// latest version can not be released, and returns false, as does a
+// version which is no longer retained.
+func (v *Versioned[V]) Release(ver uint64) bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	i, ok := v.find(ver)
+	if !ok || i == len(v.hist)-1 {
+		return false
+	}
+	copy(v.hist[i:], v.hist[i+1:])
+	v.hist[len(v.hist)-1] = nil
+	v.hist = v.hist[:len(v.hist)-1]
+	return true
+}
+
+// ---------------------------------------------------------------------------
+
+// find returns the position of the version within the history, and
+// whether the version is retained.
+func (v *Versioned[V]) find(ver uint64) (int, bool) {
+	i := sort.Search(len(v.hist), func(i int) bool {
+		return v.hist[i].ver >= ver
+	})
+	return i, i < len(v.hist) && v.hist[i].ver == ver
+}
+
+// prune removes any versions which are no longer retained by the
+// retention policy, always keeping the latest version.
+func (v *Versioned[V]) prune() {
+
+	i := 0
+
+	if v.count > 0 && len(v.hist) > v.count {
+		i = len(v.hist) - v.count
+	}
+
+	if v.age > 0 {
+		old := v.now().Add(-v.age)
+		for i < len(v.hist)-1 && v.hist[i].time.Before(old) {
+			i++
+		}
+	}
+
+	for j := 0; j < i; j++ {
+		v.hist[j] = nil
+	}
+
+	v.hist = v.hist[i:]
+
+}
@@ -0,0 +1,89 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVersioned(t *testing.T) {
+
+	put := func(v *Versioned[int], key string, val int) uint64 {
+		c := v.Copy()
+		c.Put([]byte(key), val)
+		return v.Commit(c)
+	}
+
+	Convey("Can read past versions", t, func() {
+		v := NewVersioned[int](nil)
+		So(v.Version(), ShouldEqual, 0)
+		So(v.At(0).Size(), ShouldEqual, 0)
+		So(put(v, "/one", 1), ShouldEqual, 1)
+		So(put(v, "/one", 2), ShouldEqual, 2)
+		So(put(v, "/two", 3), ShouldEqual, 3)
+		So(v.Version(), ShouldEqual, 3)
+		So(v.Versions(), ShouldResemble, []uint64{0, 1, 2, 3})
+		So(v.At(1).Get([]byte("/one")), ShouldEqual, 1)
+		So(v.At(2).Get([]byte("/one")), ShouldEqual, 2)
+		So(v.At(2).Size(), ShouldEqual, 1)
+		So(v.At(3), ShouldEqual, v.Tree())
+		So(v.At(4), ShouldBeNil)
+	})
+
+	Convey("Can release versions", t, func() {
+		v := NewVersioned[int](nil)
+		put(v, "/one", 1)
+		put(v, "/two", 2)
+		So(v.Release(1), ShouldBeTrue)
+		So(v.Release(1), ShouldBeFalse)
+		So(v.Release(2), ShouldBeFalse)
+		So(v.At(1), ShouldBeNil)
+		So(v.At(2).Size(), ShouldEqual, 2)
+		So(v.Versions(), ShouldResemble, []uint64{0, 2})
+	})
+
+	Convey("Can retain a number of versions", t, func() {
+		v := NewVersioned[int](nil)
+		for i := 0; i < 10; i++ {
+			put(v, "/one", i)
+		}
+		v.Retain(3, 0)
+		So(v.Versions(), ShouldResemble, []uint64{8, 9, 10})
+		put(v, "/one", 10)
+		So(v.Versions(), ShouldResemble, []uint64{9, 10, 11})
+		So(v.At(9).Get([]byte("/one")), ShouldEqual, 8)
+	})
+
+	Convey("Can retain versions by age", t, func() {
+		now := time.Now()
+		v := NewVersioned[int](nil)
+		v.now = func() time.Time { return now }
+		put(v, "/one", 1)
+		now = now.Add(time.Minute)
+		put(v, "/one", 2)
+		now = now.Add(time.Minute)
+		put(v, "/one", 3)
+		v.Retain(0, 90*time.Second)
+		So(v.Versions(), ShouldResemble, []uint64{2, 3})
+		now = now.Add(time.Hour)
+		v.Retain(0, time.Minute)
+		So(v.Versions(), ShouldResemble, []uint64{3})
+		So(v.Tree().Get([]byte("/one")), ShouldEqual, 3)
+	})
+
+}
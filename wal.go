@@ -0,0 +1,513 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	walFile  = "wal"
+	snapFile = "snapshot"
+)
+
+const (
+	walPut = 1
+	walDel = 2
+	// walDelRange deletes the keys from a start key up to an end key,
+	// and walDelFrom deletes every key from a start key onwards.
+	walDelRange = 3
+	walDelFrom  = 4
+)
+
+var (
+	// ErrNotDurable is returned when compacting a DB which was not
+	// opened from a directory using Open.
+	ErrNotDurable = errors.New("ptree: database is not durable")
+	// ErrCorruptLog is returned when opening a DB whose write-ahead
+	// log contains a record which can not be read, followed by any
+	// records which can.
+	ErrCorruptLog = errors.New("ptree: corrupt write-ahead log")
+)
+
+// errTorn is returned when a record in the log is incomplete, or does
+// not match its checksum, as if it had only been partially written.
+var errTorn = errors.New("ptree: torn write-ahead log record")
+
+type wal[V any] struct {
+	dir   string
+	file  *os.File
+	codec Codec[V]
+	opts  []Option[V]
+	seq   uint64
+	off   int64
+	err   error
+}
+
+// Open opens a durable DB which is stored within the specified
+// directory, creating it if necessary. The tree is rebuilt from
+// the latest snapshot, and any transactions which were appended
+// to the write-ahead log since then. Every committed transaction
+// is appended to the log, and synced to disk, before it is made
+// visible. Values are encoded using the codec, and the tree is
+// configured using any specified options.
+func Open[V any](dir string, c Codec[V], opts ...Option[V]) (*DB[V], error) {
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	w := &wal[V]{dir: dir, codec: c, opts: opts}
+
+	t, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+
+	if t, err = w.replay(t); err != nil {
+		return nil, err
+	}
+
+	db := NewDB(t)
+	db.wal = w
+
+	return db, nil
+
+}
+
+// Compact writes the latest committed tree to a new snapshot, and
+// truncates the write-ahead log. This returns ErrNotDurable if the
+// DB was not opened using Open.
+func (db *DB[V]) Compact() error {
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.wal == nil {
+		return ErrNotDurable
+	}
+
+	return db.wal.compact(db.tree.Load())
+
+}
+
+// Close closes the write-ahead log of a durable DB. Any subsequent
+// commits will fail. Closing a DB which is not durable does nothing.
+func (db *DB[V]) Close() error {
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.wal == nil {
+		return nil
+	}
+
+	return db.wal.file.Close()
+
+}
+
+// ---------------------------------------------------------------------------
+
+// load reads the latest snapshot from disk, if there is one.
+func (w *wal[V]) load() (*TreeOf[V], error) {
+
+	f, err := os.Open(filepath.Join(w.dir, snapFile))
+	if os.IsNotExist(err) {
+		return NewTree[V](w.opts...), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	var seq [8]byte
+	if _, err := io.ReadFull(r, seq[:]); err != nil {
+		return nil, corrupt(err)
+	}
+
+	w.seq = binary.BigEndian.Uint64(seq[:])
+
+	s := NewSnapshot(w.codec, w.opts...)
+	if _, err := s.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	return s.Tree(), nil
+
+}
+
+// replay applies any transactions in the log which are newer than
+// the snapshot. A partially written transaction at the end of the
+// log is discarded, as it was never committed. A record which can not
+// be read is only treated as such if no valid record follows it, and
+// otherwise ErrCorruptLog is returned, so that later committed
+// transactions are not lost.
+func (w *wal[V]) replay(t *TreeOf[V]) (*TreeOf[V], error) {
+
+	f, err := os.OpenFile(filepath.Join(w.dir, walFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	c := t.Copy()
+	r := bufio.NewReader(f)
+
+	var off int64
+
+	for {
+		n, err := w.read(r, c, info.Size()-off)
+		if err == io.EOF {
+			break
+		}
+		if err == errTorn {
+			ok, err := follows(f, off+1, info.Size())
+			if err == nil && ok {
+				err = ErrCorruptLog
+			}
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		off += n
+	}
+
+	if err := f.Truncate(off); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	w.off = off
+	w.file = f
+
+	return c.Tree(), nil
+
+}
+
+// read reads a single transaction from the log, applying it to the
+// copy if it is newer than the snapshot, and returning its length.
+// At the end of the log io.EOF is returned, and a transaction which
+// is incomplete, or which does not match its checksum, returns
+// errTorn.
+func (w *wal[V]) read(r *bufio.Reader, c *CopyOf[V], remain int64) (int64, error) {
+
+	size, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		return 0, err
+	}
+	if err != nil || size == 0 || size > uint64(remain) {
+		return 0, errTorn
+	}
+
+	rec := make([]byte, size+4)
+	if _, err := io.ReadFull(r, rec); err != nil {
+		return 0, errTorn
+	}
+
+	body, sum := rec[:size], rec[size:]
+	if crc32.Checksum(body, castagnoli) != binary.BigEndian.Uint32(sum) {
+		return 0, errTorn
+	}
+
+	seq, n := binary.Uvarint(body)
+	if n <= 0 {
+		return 0, ErrCorruptLog
+	}
+
+	// Skip transactions already in the snapshot
+	if seq <= w.seq {
+		return int64(uvarintLen(size)) + int64(len(rec)), nil
+	}
+
+	// Decode every operation before applying any
+	type op struct {
+		kind byte
+		key  []byte
+		end  []byte
+		val  V
+	}
+
+	var ops []op
+
+	for body = body[n:]; len(body) > 0; {
+		var o op
+		o.kind = body[0]
+		if o.key, body, err = walBytes(body[1:]); err != nil {
+			return 0, err
+		}
+		switch o.kind {
+		case walPut:
+			var data []byte
+			if data, body, err = walBytes(body); err != nil {
+				return 0, err
+			}
+			if o.val, err = w.codec.Decode(data); err != nil {
+				return 0, err
+			}
+		case walDelRange:
+			if o.end, body, err = walBytes(body); err != nil {
+				return 0, err
+			}
+		case walDel, walDelFrom:
+		default:
+			return 0, ErrCorruptLog
+		}
+		ops = append(ops, o)
+	}
+
+	for _, o := range ops {
+		switch o.kind {
+		case walPut:
+			c.Put(o.key, o.val)
+		case walDel:
+			c.Del(o.key)
+		default:
+			c.DeleteRange(o.key, o.end)
+		}
+	}
+
+	w.seq = seq
+
+	return int64(uvarintLen(size)) + int64(len(rec)), nil
+
+}
+
+// write appends a transaction containing the deleted ranges, followed
+// by the final values of the modified keys, to the log, and syncs the
+// log to disk.
+func (w *wal[V]) write(t *TreeOf[V], dirty *writes) error {
+
+	sorted := make([]string, 0, len(dirty.keys))
+	for k := range dirty.keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	body := binary.AppendUvarint(nil, w.seq+1)
+
+	for _, s := range dirty.spans {
+		if s.end == nil {
+			body = append(body, walDelFrom)
+		} else {
+			body = append(body, walDelRange)
+		}
+		body = binary.AppendUvarint(body, uint64(len(s.start)))
+		body = append(body, s.start...)
+		if s.end != nil {
+			body = binary.AppendUvarint(body, uint64(len(s.end)))
+			body = append(body, s.end...)
+		}
+	}
+
+	for _, k := range sorted {
+		if v, ok := t.GetOK([]byte(k)); ok {
+			data, err := w.codec.Encode(v)
+			if err != nil {
+				return err
+			}
+			body = append(body, walPut)
+			body = binary.AppendUvarint(body, uint64(len(k)))
+			body = append(body, k...)
+			body = binary.AppendUvarint(body, uint64(len(data)))
+			body = append(body, data...)
+		} else {
+			body = append(body, walDel)
+			body = binary.AppendUvarint(body, uint64(len(k)))
+			body = append(body, k...)
+		}
+	}
+
+	rec := binary.AppendUvarint(nil, uint64(len(body)))
+	rec = append(rec, body...)
+	rec = binary.BigEndian.AppendUint32(rec, crc32.Checksum(body, castagnoli))
+
+	if w.err != nil {
+		return w.err
+	}
+
+	if err := w.append(rec); err != nil {
+		return err
+	}
+
+	w.seq++
+
+	return nil
+
+}
+
+// append writes a record to the end of the log, and syncs it to disk.
+// If the record can not be written, then the log is truncated back to
+// its previous length, so that the next record follows the last one
+// which was committed. If that fails too, then the log is marked as
+// failed, and every subsequent write returns the same error.
+func (w *wal[V]) append(rec []byte) error {
+
+	_, err := w.file.Write(rec)
+	if err == nil {
+		err = w.file.Sync()
+	}
+
+	if err == nil {
+		w.off += int64(len(rec))
+		return nil
+	}
+
+	if terr := w.file.Truncate(w.off); terr != nil {
+		w.err = terr
+	} else if _, serr := w.file.Seek(w.off, io.SeekStart); serr != nil {
+		w.err = serr
+	}
+
+	return err
+
+}
+
+// compact writes the tree to a new snapshot, replacing the current
+// snapshot once it has been synced to disk, and truncates the log.
+func (w *wal[V]) compact(t *TreeOf[V]) error {
+
+	tmp := filepath.Join(w.dir, snapFile+".tmp")
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], w.seq)
+
+	bw := bufio.NewWriter(f)
+	bw.Write(seq[:])
+
+	if _, err := t.Snapshot(w.codec).WriteTo(bw); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, filepath.Join(w.dir, snapFile)); err != nil {
+		return err
+	}
+
+	if err := syncDir(w.dir); err != nil {
+		return err
+	}
+
+	// The log is only truncated once the snapshot is safely on disk,
+	// and any transactions left behind by a crash are skipped.
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	w.off, w.err = 0, nil
+
+	return w.file.Sync()
+
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// follows returns whether a complete record, which matches its
+// checksum, starts anywhere in the log between the offsets.
+func follows(f *os.File, off, end int64) (bool, error) {
+
+	if off >= end {
+		return false, nil
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(f, off, end-off))
+	if err != nil {
+		return false, err
+	}
+
+	for p := range data {
+		size, l := binary.Uvarint(data[p:])
+		if l <= 0 || size == 0 || size+4 > uint64(len(data)-p-l) {
+			continue
+		}
+		body := data[p+l : p+l+int(size)]
+		if crc32.Checksum(body, castagnoli) != binary.BigEndian.Uint32(data[p+l+int(size):]) {
+			continue
+		}
+		if _, n := binary.Uvarint(body); n > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+
+}
+
+func walBytes(b []byte) ([]byte, []byte, error) {
+	n, l := binary.Uvarint(b)
+	if l <= 0 || uint64(len(b)-l) < n {
+		return nil, nil, ErrCorruptLog
+	}
+	return b[l : l+int(n)], b[l+int(n):], nil
+}
+
+func uvarintLen(v uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], v)
+}
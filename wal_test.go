@@ -0,0 +1,294 @@
+// Copyright © SurrealDB Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ptree
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWAL(t *testing.T) {
+
+	dir := t.TempDir()
+
+	Convey("Can open an empty directory", t, func() {
+		db, err := Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		So(db.Tree().Size(), ShouldEqual, 0)
+		So(db.Close(), ShouldBeNil)
+	})
+
+	Convey("Can rebuild the tree from the log", t, func() {
+		db, err := Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		tx := db.Begin()
+		tx.Put([]byte("/one"), 1)
+		tx.Put([]byte("/two"), 2)
+		tx.Put([]byte("/tre"), 3)
+		So(tx.Commit(), ShouldBeNil)
+		So(db.Update(func(c *CopyOf[int]) error {
+			c.Del([]byte("/two"))
+			c.Put([]byte("/one"), 10)
+			return nil
+		}), ShouldBeNil)
+		So(db.Close(), ShouldBeNil)
+		db, err = Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		So(db.Tree().Size(), ShouldEqual, 2)
+		So(db.Tree().Get([]byte("/one")), ShouldEqual, 10)
+		So(db.Tree().Get([]byte("/tre")), ShouldEqual, 3)
+		So(db.Close(), ShouldBeNil)
+	})
+
+	Convey("Can rebuild deleted prefixes and ranges from the log", t, func() {
+		dir := t.TempDir()
+		db, err := Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		So(db.Update(func(c *CopyOf[int]) error {
+			for i, k := range []string{"/a/1", "/a/2", "/b/1", "/b/2", "/c/1", "/c/2", "/d"} {
+				c.Put([]byte(k), i)
+			}
+			return nil
+		}), ShouldBeNil)
+		So(db.Update(func(c *CopyOf[int]) error {
+			c.DeletePrefix([]byte("/a/"))
+			c.Put([]byte("/a/3"), 3)
+			c.DeleteRange([]byte("/b/2"), []byte("/c/2"))
+			c.DeleteRange([]byte("/d"), nil)
+			return nil
+		}), ShouldBeNil)
+		So(db.Close(), ShouldBeNil)
+		db, err = Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		var keys []string
+		db.Tree().Walk(nil, func(k []byte, _ int) bool {
+			keys = append(keys, string(k))
+			return false
+		})
+		So(keys, ShouldResemble, []string{"/a/3", "/b/1", "/c/2"})
+		So(db.Close(), ShouldBeNil)
+	})
+
+	Convey("Does not log discarded transactions", t, func() {
+		db, err := Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		tx := db.Begin()
+		tx.Put([]byte("/for"), 4)
+		tx.Discard()
+		a, b := db.Begin(), db.Begin()
+		a.Put([]byte("/fiv"), 5)
+		b.Put([]byte("/fiv"), 50)
+		So(a.Commit(), ShouldBeNil)
+		So(b.Commit(), ShouldEqual, ErrConflict)
+		So(db.Close(), ShouldBeNil)
+		db, err = Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		So(db.Tree().Size(), ShouldEqual, 3)
+		So(db.Tree().Get([]byte("/fiv")), ShouldEqual, 5)
+		_, ok := db.Tree().GetOK([]byte("/for"))
+		So(ok, ShouldBeFalse)
+		So(db.Close(), ShouldBeNil)
+	})
+
+	Convey("Discards a partially written transaction", t, func() {
+		log := filepath.Join(dir, walFile)
+		info, err := os.Stat(log)
+		So(err, ShouldBeNil)
+		db, err := Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/six"), 6)
+			return nil
+		})
+		So(db.Close(), ShouldBeNil)
+		So(os.Truncate(log, info.Size()+3), ShouldBeNil)
+		db, err = Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		So(db.Tree().Size(), ShouldEqual, 3)
+		_, ok := db.Tree().GetOK([]byte("/six"))
+		So(ok, ShouldBeFalse)
+		So(db.Close(), ShouldBeNil)
+	})
+
+	Convey("Can compact the log into a snapshot", t, func() {
+		db, err := Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		So(db.Compact(), ShouldBeNil)
+		info, err := os.Stat(filepath.Join(dir, walFile))
+		So(err, ShouldBeNil)
+		So(info.Size(), ShouldEqual, 0)
+		db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/sev"), 7)
+			return nil
+		})
+		So(db.Close(), ShouldBeNil)
+		db, err = Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		So(db.Tree().Size(), ShouldEqual, 4)
+		So(db.Tree().Get([]byte("/one")), ShouldEqual, 10)
+		So(db.Tree().Get([]byte("/sev")), ShouldEqual, 7)
+		So(db.Close(), ShouldBeNil)
+	})
+
+	Convey("Skips logged transactions already in the snapshot", t, func() {
+		db, err := Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/sev"), 70)
+			return nil
+		})
+		log, err := os.ReadFile(filepath.Join(dir, walFile))
+		So(err, ShouldBeNil)
+		So(db.Compact(), ShouldBeNil)
+		db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/sev"), 700)
+			return nil
+		})
+		So(db.Compact(), ShouldBeNil)
+		So(db.Close(), ShouldBeNil)
+		// Simulate a crash before the log was truncated
+		So(os.WriteFile(filepath.Join(dir, walFile), log, 0644), ShouldBeNil)
+		db, err = Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		So(db.Tree().Get([]byte("/sev")), ShouldEqual, 700)
+		So(db.Close(), ShouldBeNil)
+	})
+
+	Convey("Discards a record which is longer than the log", t, func() {
+		dir := t.TempDir()
+		log := binary.AppendUvarint(nil, 1<<50)
+		So(os.WriteFile(filepath.Join(dir, walFile), append(log, 1, 2, 3), 0644), ShouldBeNil)
+		db, err := Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		So(db.Tree().Size(), ShouldEqual, 0)
+		info, err := os.Stat(filepath.Join(dir, walFile))
+		So(err, ShouldBeNil)
+		So(info.Size(), ShouldEqual, 0)
+		So(db.Close(), ShouldBeNil)
+	})
+
+	Convey("Does not discard the log after a corrupt record", t, func() {
+		dir := t.TempDir()
+		db, err := Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/one"), 1)
+			return nil
+		})
+		db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/two"), 2)
+			return nil
+		})
+		So(db.Close(), ShouldBeNil)
+		log, err := os.ReadFile(filepath.Join(dir, walFile))
+		So(err, ShouldBeNil)
+		log[3] ^= 0xff
+		So(os.WriteFile(filepath.Join(dir, walFile), log, 0644), ShouldBeNil)
+		_, err = Open[int](dir, intCodec{})
+		So(err, ShouldEqual, ErrCorruptLog)
+		info, err := os.Stat(filepath.Join(dir, walFile))
+		So(err, ShouldBeNil)
+		So(info.Size(), ShouldEqual, len(log))
+	})
+
+	Convey("Discards zero bytes written after the last record", t, func() {
+		dir := t.TempDir()
+		db, err := Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/one"), 1)
+			return nil
+		})
+		So(db.Close(), ShouldBeNil)
+		log, err := os.ReadFile(filepath.Join(dir, walFile))
+		So(err, ShouldBeNil)
+		So(os.WriteFile(filepath.Join(dir, walFile), append(log, make([]byte, 16)...), 0644), ShouldBeNil)
+		db, err = Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		So(db.Tree().Get([]byte("/one")), ShouldEqual, 1)
+		info, err := os.Stat(filepath.Join(dir, walFile))
+		So(err, ShouldBeNil)
+		So(info.Size(), ShouldEqual, len(log))
+		So(db.Close(), ShouldBeNil)
+	})
+
+	Convey("Discards a last record which does not match its checksum", t, func() {
+		dir := t.TempDir()
+		db, err := Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/one"), 1)
+			return nil
+		})
+		info, err := os.Stat(filepath.Join(dir, walFile))
+		So(err, ShouldBeNil)
+		db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/two"), 2)
+			return nil
+		})
+		So(db.Close(), ShouldBeNil)
+		log, err := os.ReadFile(filepath.Join(dir, walFile))
+		So(err, ShouldBeNil)
+		log[len(log)-1] ^= 0xff
+		So(os.WriteFile(filepath.Join(dir, walFile), log, 0644), ShouldBeNil)
+		db, err = Open[int](dir, intCodec{})
+		So(err, ShouldBeNil)
+		So(db.Tree().Get([]byte("/one")), ShouldEqual, 1)
+		_, ok := db.Tree().GetOK([]byte("/two"))
+		So(ok, ShouldBeFalse)
+		trunc, err := os.Stat(filepath.Join(dir, walFile))
+		So(err, ShouldBeNil)
+		So(trunc.Size(), ShouldEqual, info.Size())
+		So(db.Close(), ShouldBeNil)
+	})
+
+	Convey("Does not apply a transaction which could not be logged", t, func() {
+		dir := t.TempDir()
+		var feed []Change[int]
+		db, err := Open[int](dir, intCodec{}, WithSubscriber(func(c []Change[int]) {
+			feed = append(feed, c...)
+		}))
+		So(err, ShouldBeNil)
+		watch := db.Tree().Watch(nil)
+		So(db.wal.file.Close(), ShouldBeNil)
+		err = db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/one"), 1)
+			return nil
+		})
+		So(err, ShouldNotBeNil)
+		So(db.Tree().Size(), ShouldEqual, 0)
+		So(feed, ShouldBeEmpty)
+		So(closed(watch), ShouldBeFalse)
+		tx := db.Begin()
+		tx.Put([]byte("/one"), 1)
+		So(tx.Commit(), ShouldNotBeNil)
+		So(feed, ShouldBeEmpty)
+		So(db.wal.err, ShouldNotBeNil)
+		err = db.Update(func(c *CopyOf[int]) error {
+			c.Put([]byte("/two"), 2)
+			return nil
+		})
+		So(err, ShouldEqual, db.wal.err)
+	})
+
+	Convey("Cannot compact a database which is not durable", t, func() {
+		So(NewDB[int](nil).Compact(), ShouldEqual, ErrNotDurable)
+	})
+
+}